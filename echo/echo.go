@@ -0,0 +1,319 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justseemore/gospider/http2"
+	"github.com/justseemore/gospider/ja3"
+	"github.com/justseemore/gospider/tools"
+)
+
+type ServerOption struct {
+	Addr       string        //监听地址,default:127.0.0.1:0
+	ServerName string        //证书的域名,default:localhost
+	DisHttp2   bool          //关闭http2,只使用http1.1
+	Timeout    time.Duration //tls 握手超时时间,default:15
+}
+
+// 返回给客户端的指纹信息
+type Response struct {
+	Proto   string      `json:"proto"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Headers [][2]string `json:"headers"` //请求头,保持发送的顺序和大小写,http2 包括伪标头
+	Body    string      `json:"body"`
+	Tls     Tls         `json:"tls"`
+	H2      *H2         `json:"h2,omitempty"` //http2 指纹,http1.1 时为nil
+}
+type Tls struct {
+	Version     uint16              `json:"version"`
+	CipherSuite uint16              `json:"cipherSuite"`
+	ServerName  string              `json:"serverName"`
+	Alpn        string              `json:"alpn"` //协商的协议
+	Ja3         string              `json:"ja3"`
+	Ja3Hash     string              `json:"ja3Hash"`
+	Ja3n        string              `json:"ja3n"`
+	Ja3nHash    string              `json:"ja3nHash"`
+	Ja4         string              `json:"ja4"`
+	Name        string              `json:"name"` //指纹库中的名称
+	Hello       *ja3.RawClientHello `json:"hello"`
+}
+type H2 struct {
+	Akamai      string             `json:"akamai"`
+	AkamaiHash  string             `json:"akamaiHash"`
+	Name        string             `json:"name"` //指纹库中的名称
+	Fingerprint *ja3.H2Fingerprint `json:"fingerprint"`
+}
+
+// 指纹回显服务,用于离线测试客户端发送的指纹
+type Server struct {
+	ctx       context.Context
+	cnl       context.CancelFunc
+	ln        net.Listener
+	h1Ln      *connListener
+	h1Server  *http.Server
+	upg       *http2.Upg
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	conns     map[net.Conn]struct{}
+	lock      sync.Mutex
+}
+
+type connInfoKey struct{}
+type connInfo struct {
+	state tls.ConnectionState
+	hello *ja3.RawClientHello
+	conn  *rawConn
+}
+
+// 记录http1.1 读取的原始内容,用于获取请求头的顺序和大小写
+type rawConn struct {
+	net.Conn
+	lock sync.Mutex
+	buf  []byte
+}
+
+func (obj *rawConn) Read(b []byte) (int, error) {
+	n, err := obj.Conn.Read(b)
+	if n > 0 {
+		obj.lock.Lock()
+		obj.buf = append(obj.buf, b[:n]...)
+		obj.lock.Unlock()
+	}
+	return n, err
+}
+
+// 取出当前请求的请求头,并清空已读取的内容
+func (obj *rawConn) headers() [][2]string {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	i := bytes.Index(obj.buf, []byte("\r\n\r\n"))
+	if i == -1 {
+		return nil
+	}
+	lines := strings.Split(string(obj.buf[:i]), "\r\n")
+	headers := [][2]string{}
+	for _, line := range lines[1:] {
+		key, val, _ := strings.Cut(line, ":")
+		headers = append(headers, [2]string{key, strings.TrimSpace(val)})
+	}
+	return headers
+}
+func (obj *rawConn) reset() {
+	obj.lock.Lock()
+	obj.buf = nil
+	obj.lock.Unlock()
+}
+
+func (obj *rawConn) info() *connInfo {
+	tlsConn := obj.Conn.(*tls.Conn)
+	return &connInfo{
+		state: tlsConn.ConnectionState(),
+		hello: ja3.GetClientHello(tlsConn),
+		conn:  obj,
+	}
+}
+
+// http1.1 的连接交给http.Server 处理
+type connListener struct {
+	addr net.Addr
+	ch   chan net.Conn
+	ctx  context.Context
+}
+
+func (obj *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-obj.ch:
+		return conn, nil
+	case <-obj.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+func (obj *connListener) Close() error {
+	return nil
+}
+func (obj *connListener) Addr() net.Addr {
+	return obj.addr
+}
+
+// 创建并启动指纹回显服务
+func NewServer(preCtx context.Context, options ...ServerOption) (*Server, error) {
+	if preCtx == nil {
+		preCtx = context.TODO()
+	}
+	var option ServerOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Addr == "" {
+		option.Addr = "127.0.0.1:0"
+	}
+	if option.ServerName == "" {
+		option.ServerName = "localhost"
+	}
+	if option.Timeout == 0 {
+		option.Timeout = time.Second * 15
+	}
+	cert, err := tools.CreateProxyCertWithName(option.ServerName)
+	if err != nil {
+		return nil, tools.WrapError(err, "echo 创建证书错误")
+	}
+	ln, err := net.Listen("tcp", option.Addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cnl := context.WithCancel(preCtx)
+	server := &Server{
+		ctx:     ctx,
+		cnl:     cnl,
+		ln:      ja3.NewListener(ln),
+		upg:     http2.NewUpg(nil, http2.UpgOption{Server: true}),
+		timeout: option.Timeout,
+		conns:   make(map[net.Conn]struct{}),
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+		},
+	}
+	if option.DisHttp2 {
+		server.tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+	server.h1Ln = &connListener{addr: ln.Addr(), ch: make(chan net.Conn), ctx: ctx}
+	server.h1Server = &http.Server{
+		Handler: server,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connInfoKey{}, c.(*rawConn).info())
+		},
+	}
+	go server.h1Server.Serve(server.h1Ln)
+	go server.run()
+	return server, nil
+}
+func (obj *Server) run() {
+	defer obj.Close()
+	for {
+		conn, err := obj.ln.Accept()
+		if err != nil {
+			return
+		}
+		obj.lock.Lock()
+		obj.conns[conn] = struct{}{}
+		obj.lock.Unlock()
+		go obj.serveConn(conn)
+	}
+}
+func (obj *Server) serveConn(conn net.Conn) {
+	defer func() {
+		obj.lock.Lock()
+		delete(obj.conns, conn)
+		obj.lock.Unlock()
+	}()
+	tlsConn := tls.Server(conn, obj.tlsConfig)
+	ctx, cnl := context.WithTimeout(obj.ctx, obj.timeout)
+	err := tlsConn.HandshakeContext(ctx)
+	cnl()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+		info := &connInfo{state: tlsConn.ConnectionState(), hello: ja3.GetClientHello(conn)}
+		obj.upg.ServerConn(context.WithValue(obj.ctx, connInfoKey{}, info), tlsConn, obj)
+		return
+	}
+	select {
+	case obj.h1Ln.ch <- &rawConn{Conn: tlsConn}:
+	case <-obj.ctx.Done():
+		conn.Close()
+	}
+}
+
+// 返回请求的指纹信息
+func (obj *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	info, ok := r.Context().Value(connInfoKey{}).(*connInfo)
+	if !ok {
+		http.Error(w, "not found conn info", http.StatusInternalServerError)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result := Response{
+		Proto:  r.Proto,
+		Method: r.Method,
+		Path:   r.URL.RequestURI(),
+		Body:   string(body),
+		Tls: Tls{
+			Version:     info.state.Version,
+			CipherSuite: info.state.CipherSuite,
+			ServerName:  info.state.ServerName,
+			Alpn:        info.state.NegotiatedProtocol,
+		},
+	}
+	if info.conn != nil {
+		result.Headers = info.conn.headers()
+		info.conn.reset()
+	} else {
+		result.Headers = http2.GetRequestRawHeaders(r)
+	}
+	if fp := http2.GetRequestH2Fingerprint(r); fp != nil {
+		result.H2 = &H2{
+			Akamai:      fp.String(),
+			AkamaiHash:  fp.Hash(),
+			Fingerprint: fp,
+		}
+		if entry, ok := ja3.DefaultDb().LookupH2(result.H2.AkamaiHash); ok {
+			result.H2.Name = entry.Name()
+		}
+	}
+	if hello := info.hello; hello != nil {
+		result.Tls.Hello = hello
+		result.Tls.Ja3 = hello.Ja3()
+		result.Tls.Ja3Hash = hello.Ja3Hash()
+		result.Tls.Ja3n = hello.Ja3n()
+		result.Tls.Ja3nHash = hello.Ja3nHash()
+		result.Tls.Ja4 = hello.Ja4()
+		result.Tls.Name, _ = ja3.Ja3ContextData{Hello: hello}.Verify()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// 监听的地址
+func (obj *Server) Addr() string {
+	return obj.ln.Addr().String()
+}
+
+// 请求的地址,例如:https://127.0.0.1:8999
+func (obj *Server) Url() string {
+	return "https://" + obj.Addr()
+}
+
+// 关闭服务
+func (obj *Server) Close() error {
+	obj.cnl()
+	err := obj.ln.Close()
+	obj.h1Server.Close()
+	obj.lock.Lock()
+	for conn := range obj.conns {
+		conn.Close()
+	}
+	obj.conns = make(map[net.Conn]struct{})
+	obj.lock.Unlock()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
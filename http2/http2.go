@@ -52,6 +52,26 @@ type UpgOption struct {
 	Server                bool //是否为服务端
 }
 
+type orderHeadersKey struct{}
+type h2FingerprintKey struct{}
+type rawHeadersKey struct{}
+
+// 获取服务端收到的原始请求头,包括伪标头,保持发送的顺序,需要使用Upg.ServerConn 处理连接
+func GetRequestRawHeaders(r *http.Request) [][2]string {
+	headers, _ := r.Context().Value(rawHeadersKey{}).([][2]string)
+	return headers
+}
+
+// 获取服务端收到的http2 指纹,需要使用Upg.ServerConn 处理连接
+func GetRequestH2Fingerprint(r *http.Request) *ja3.H2Fingerprint {
+	fp, _ := r.Context().Value(h2FingerprintKey{}).(*ja3.H2Fingerprint)
+	return fp
+}
+
+// 设置请求头的顺序,在H2Ja3Spec.OrderHeaders 的伪标头之后发送
+func WithOrderHeaders(ctx context.Context, orderHeaders []string) context.Context {
+	return context.WithValue(ctx, orderHeadersKey{}, orderHeaders)
+}
 func NewUpg(t1 *http.Transport, options ...UpgOption) *Upg {
 	//初始化参数
 	var option UpgOption
@@ -157,6 +177,10 @@ func (obj *Upg) UpgradeFn(authority string, c net.Conn) http.RoundTripper {
 	}
 	return obj.t
 }
+// 配置http.Server 使用此服务端处理h2 连接,用于获取客户端的http2 指纹
+func (obj *Upg) ConfigureServer(s *http.Server) error {
+	return http2ConfigureServer(s, obj.server)
+}
 func (obj *Upg) ServerConn(ctx context.Context, c net.Conn, h http.Handler) {
 	obj.server.ServeConn(c, &http2ServeConnOpts{
 		Context: ctx,
@@ -4455,6 +4479,10 @@ type http2serverConn struct {
 
 	// Used by startGracefulShutdown.
 	shutdownOnce sync.Once
+
+	h2Fingerprint    ja3.H2Fingerprint //客户端的http2 指纹,由serve 循环修改
+	sawFirstHeaders  bool
+	sawFirstConnFlow bool
 }
 
 func (sc *http2serverConn) maxHeaderListSize() uint32 {
@@ -5444,6 +5472,10 @@ func (sc *http2serverConn) processWindowUpdate(f *http2WindowUpdateFrame) error
 			return sc.countError("bad_flow", http2streamError(f.StreamID, http2ErrCodeFlowControl))
 		}
 	default: // connection-level flow control
+		if !sc.sawFirstConnFlow {
+			sc.sawFirstConnFlow = true
+			sc.h2Fingerprint.ConnFlow = f.Increment
+		}
 		if !sc.flow.add(int32(f.Increment)) {
 			return http2goAwayFlowError{}
 		}
@@ -5535,6 +5567,13 @@ func (sc *http2serverConn) processSettings(f *http2SettingsFrame) error {
 		// duplicate entries.
 		return sc.countError("settings_big_or_dups", http2ConnectionError(http2ErrCodeProtocol))
 	}
+	if sc.h2Fingerprint.Settings == nil {
+		sc.h2Fingerprint.Settings = []ja3.Setting{}
+		f.ForeachSetting(func(setting http2Setting) error {
+			sc.h2Fingerprint.Settings = append(sc.h2Fingerprint.Settings, ja3.Setting{Id: uint16(setting.ID), Val: setting.Val})
+			return nil
+		})
+	}
 	if err := f.ForeachSetting(sc.processSetting); err != nil {
 		return err
 	}
@@ -5844,6 +5883,13 @@ func (sc *http2serverConn) processHeaders(f *http2MetaHeadersFrame) error {
 		}
 		sc.writeSched.AdjustStream(st.id, f.Priority)
 	}
+	sc.sawFirstHeaders = true
+	st.ctx = context.WithValue(st.ctx, h2FingerprintKey{}, sc.requestH2Fingerprint(f))
+	rawHeaders := make([][2]string, len(f.Fields))
+	for i, field := range f.Fields {
+		rawHeaders[i] = [2]string{field.Name, field.Value}
+	}
+	st.ctx = context.WithValue(st.ctx, rawHeadersKey{}, rawHeaders)
 
 	rw, req, err := sc.newWriterAndRequest(st, f)
 	if err != nil {
@@ -5948,9 +5994,38 @@ func (sc *http2serverConn) processPriority(f *http2PriorityFrame) error {
 		return err
 	}
 	sc.writeSched.AdjustStream(f.StreamID, f.http2PriorityParam)
+	if !sc.sawFirstHeaders {
+		sc.h2Fingerprint.PriorityFrames = append(sc.h2Fingerprint.PriorityFrames, ja3.H2PriorityFrame{
+			StreamId: f.StreamID,
+			Priority: ja3.Priority{
+				StreamDep: f.StreamDep,
+				Exclusive: f.Exclusive,
+				Weight:    f.Weight,
+			},
+		})
+	}
 	return nil
 }
 
+// 每个请求的http2 指纹,伪标头顺序和HEADERS 帧的优先级每个请求不同
+func (sc *http2serverConn) requestH2Fingerprint(f *http2MetaHeadersFrame) *ja3.H2Fingerprint {
+	fp := sc.h2Fingerprint
+	fp.Settings = append([]ja3.Setting{}, fp.Settings...)
+	fp.PriorityFrames = append([]ja3.H2PriorityFrame{}, fp.PriorityFrames...)
+	fp.OrderHeaders = []string{}
+	for _, field := range f.PseudoFields() {
+		fp.OrderHeaders = append(fp.OrderHeaders, field.Name)
+	}
+	if f.HasPriority() {
+		fp.Priority = ja3.Priority{
+			StreamDep: f.Priority.StreamDep,
+			Exclusive: f.Priority.Exclusive,
+			Weight:    f.Priority.Weight,
+		}
+	}
+	return &fp
+}
+
 func (sc *http2serverConn) newStream(id, pusherID uint32, state http2streamState) *http2stream {
 	sc.serveG.check()
 	if id == 0 {
@@ -9044,25 +9119,30 @@ func (cc *http2ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool,
 			f("user-agent", http2defaultUserAgent)
 		}
 		ll := kinds.NewSet[string]()
-		for _, kk := range cc.t.h2Ja3Spec.OrderHeaders {
-			for i := 0; i < 2; i++ {
-				if i == 1 {
-					kk = strings.Title(kk)
-				}
-				if vvs, ok := headers[kk]; ok {
-					ll.Add(kk)
-					for _, vv := range vvs {
-						f2(kk, vv)
-					}
-					break
+		orderHeaders := cc.t.h2Ja3Spec.OrderHeaders
+		if reqOrderHeaders, ok := req.Context().Value(orderHeadersKey{}).([]string); ok {
+			orderHeaders = append(append([]string{}, orderHeaders...), reqOrderHeaders...)
+		}
+		for _, kk := range orderHeaders {
+			kk = http.CanonicalHeaderKey(kk)
+			if vvs, ok := headers[kk]; ok && !ll.Has(kk) {
+				ll.Add(kk)
+				for _, vv := range vvs {
+					f2(kk, vv)
 				}
 			}
 		}
-		for kk, vvs := range headers {
-			for _, vv := range vvs {
-				if !ll.Has(kk) {
-					f2(kk, vv)
-				}
+		//剩下的请求头排序后发送,伪标头在前面
+		keys := make([]string, 0, len(headers))
+		for kk := range headers {
+			if !ll.Has(kk) {
+				keys = append(keys, kk)
+			}
+		}
+		sort.Strings(keys)
+		for _, kk := range keys {
+			for _, vv := range headers[kk] {
+				f2(kk, vv)
 			}
 		}
 	}
@@ -0,0 +1,274 @@
+package ja3
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/justseemore/gospider/tools"
+)
+
+//go:embed db.json
+var dbContent []byte
+
+const (
+	DbTypeMd5  = "md5"  //Ja3ContextData.Md5
+	DbTypeJa3  = "ja3"  //ja3 的md5
+	DbTypeJa3n = "ja3n" //ja3n 的md5
+	DbTypeJa4  = "ja4"
+	DbTypeH2   = "h2" //akamai 格式http2 指纹的md5
+)
+
+// 指纹库中的记录
+type DbEntry struct {
+	Fingerprint string  `json:"fingerprint"`
+	Type        string  `json:"type"` //指纹类型:md5,ja3,ja3n,ja4,h2
+	Browser     string  `json:"browser"`
+	Version     string  `json:"version"`
+	Os          string  `json:"os"`
+	Confidence  float64 `json:"confidence"` //可信度,0-1,相同指纹有多个记录时返回可信度最高的
+}
+
+// 名称,例如:Chrome 116 Windows
+func (obj DbEntry) Name() string {
+	names := []string{}
+	for _, name := range []string{obj.Browser, obj.Version, obj.Os} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// 指纹库,可以从json,csv 加载和合并
+type Db struct {
+	entries map[string][]DbEntry
+	lock    sync.RWMutex
+}
+
+func NewDb() *Db {
+	return &Db{entries: make(map[string][]DbEntry)}
+}
+
+var defaultDb = func() *Db {
+	db := NewDb()
+	if err := db.LoadJson(dbContent); err != nil {
+		panic(err)
+	}
+	return db
+}()
+
+// 默认的指纹库,内置的指纹,Verify 和VerifyWithMd5 使用此指纹库
+func DefaultDb() *Db {
+	return defaultDb
+}
+
+// 添加记录,指纹,类型,浏览器,版本和系统都相同时覆盖原记录,否则追加,同一指纹的记录按可信度排序。原始的ja3,ja3n 和http2 指纹保存为md5
+func (obj *Db) Add(entries ...DbEntry) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	for _, entry := range entries {
+		switch entry.Type {
+		case DbTypeJa3, DbTypeJa3n:
+			if strings.Contains(entry.Fingerprint, ",") {
+				entry.Fingerprint = tools.Hex(tools.Md5(entry.Fingerprint))
+			}
+		case DbTypeH2:
+			if strings.Contains(entry.Fingerprint, "|") {
+				entry.Fingerprint = tools.Hex(tools.Md5(entry.Fingerprint))
+			}
+		}
+		vals := obj.entries[entry.Fingerprint]
+		replaced := false
+		for i, val := range vals {
+			if val.Type == entry.Type && val.Browser == entry.Browser && val.Version == entry.Version && val.Os == entry.Os {
+				vals[i] = entry
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			vals = append(vals, entry)
+		}
+		sort.SliceStable(vals, func(i, j int) bool { return vals[i].Confidence > vals[j].Confidence })
+		obj.entries[entry.Fingerprint] = vals
+	}
+}
+
+// 合并其它指纹库
+func (obj *Db) Merge(dbs ...*Db) {
+	for _, db := range dbs {
+		obj.Add(db.Entries()...)
+	}
+}
+
+// 所有记录
+func (obj *Db) Entries() []DbEntry {
+	obj.lock.RLock()
+	defer obj.lock.RUnlock()
+	entries := []DbEntry{}
+	for _, vals := range obj.entries {
+		entries = append(entries, vals...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type < entries[j].Type
+		}
+		return entries[i].Fingerprint < entries[j].Fingerprint
+	})
+	return entries
+}
+
+// 查询指纹,types 为空时查询所有类型
+func (obj *Db) Lookup(fingerprint string, types ...string) (DbEntry, bool) {
+	obj.lock.RLock()
+	defer obj.lock.RUnlock()
+	for _, entry := range obj.entries[fingerprint] {
+		if len(types) == 0 {
+			return entry, true
+		}
+		for _, typ := range types {
+			if entry.Type == typ {
+				return entry, true
+			}
+		}
+	}
+	return DbEntry{}, false
+}
+
+// 使用ja3 或ja3 的md5 查询
+func (obj *Db) LookupJa3(ja3 string) (DbEntry, bool) {
+	if strings.Contains(ja3, ",") {
+		ja3 = tools.Hex(tools.Md5(ja3))
+	}
+	return obj.Lookup(ja3, DbTypeJa3)
+}
+
+// 使用ja3n 或ja3n 的md5 查询
+func (obj *Db) LookupJa3n(ja3n string) (DbEntry, bool) {
+	if strings.Contains(ja3n, ",") {
+		ja3n = tools.Hex(tools.Md5(ja3n))
+	}
+	return obj.Lookup(ja3n, DbTypeJa3n)
+}
+
+// 使用ja4 查询
+func (obj *Db) LookupJa4(ja4 string) (DbEntry, bool) {
+	return obj.Lookup(ja4, DbTypeJa4)
+}
+
+// 使用akamai 格式的http2 指纹或其md5 查询
+func (obj *Db) LookupH2(h2 string) (DbEntry, bool) {
+	if strings.Contains(h2, "|") {
+		h2 = tools.Hex(tools.Md5(h2))
+	}
+	return obj.Lookup(h2, DbTypeH2)
+}
+
+// 根据文件后缀加载json 或csv 文件
+func (obj *Db) Load(path string) error {
+	con, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return obj.LoadCsv(con)
+	case ".json":
+		return obj.LoadJson(con)
+	default:
+		return errors.New("不支持的指纹库文件: " + path)
+	}
+}
+
+// 加载json,格式为DbEntry 数组,也支持旧的格式:{"指纹":"名称"},其中的md5 为Ja3ContextData.Md5
+func (obj *Db) LoadJson(con []byte) error {
+	var entries []DbEntry
+	if err := json.Unmarshal(con, &entries); err != nil {
+		var names map[string]string
+		if json.Unmarshal(con, &names) != nil {
+			return err
+		}
+		for fingerprint, name := range names {
+			entries = append(entries, DbEntry{Fingerprint: fingerprint, Type: dbType(fingerprint, DbTypeMd5), Browser: name})
+		}
+	}
+	obj.Add(entries...)
+	return nil
+}
+
+// 加载csv,第一行为表头:fingerprint,type,browser,version,os,confidence,没有type 时根据指纹判断
+func (obj *Db) LoadCsv(con []byte) error {
+	reader := csv.NewReader(strings.NewReader(string(con)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	indexs := map[string]int{}
+	for i, name := range header {
+		indexs[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := indexs["fingerprint"]; !ok {
+		return errors.New("csv 中没有fingerprint 列")
+	}
+	get := func(record []string, name string) string {
+		if i, ok := indexs[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	var entries []DbEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		entry := DbEntry{
+			Fingerprint: get(record, "fingerprint"),
+			Type:        get(record, "type"),
+			Browser:     get(record, "browser"),
+			Version:     get(record, "version"),
+			Os:          get(record, "os"),
+		}
+		if entry.Fingerprint == "" {
+			continue
+		}
+		if entry.Type == "" {
+			entry.Type = dbType(entry.Fingerprint, DbTypeJa3)
+		}
+		if confidence := get(record, "confidence"); confidence != "" {
+			if entry.Confidence, err = strconv.ParseFloat(confidence, 64); err != nil {
+				return errors.New("csv 中confidence 错误: " + confidence)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	obj.Add(entries...)
+	return nil
+}
+
+// 根据指纹的格式判断类型,无法判断的md5 使用md5Type
+func dbType(fingerprint string, md5Type string) string {
+	switch {
+	case strings.Contains(fingerprint, "|"):
+		return DbTypeH2
+	case strings.Count(fingerprint, "_") == 2:
+		return DbTypeJa4
+	case strings.Contains(fingerprint, ","):
+		return DbTypeJa3
+	default:
+		return md5Type
+	}
+}
@@ -0,0 +1,147 @@
+package ja3
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/justseemore/gospider/tools"
+)
+
+// 客户端发送的PRIORITY 帧
+type H2PriorityFrame struct {
+	StreamId uint32
+	Priority Priority
+}
+
+// 服务端收到的http2 指纹
+type H2Fingerprint struct {
+	Settings       []Setting         //第一个SETTINGS 帧,保持顺序
+	ConnFlow       uint32            //第一个连接级别的WINDOW_UPDATE
+	PriorityFrames []H2PriorityFrame //第一个请求之前的PRIORITY 帧
+	OrderHeaders   []string          //伪标头顺序,例如：[]string{":method",":authority",":scheme",":path"}
+	Priority       Priority          //HEADERS 帧中的优先级,akamai 格式中没有
+}
+
+// akamai 格式的http2 指纹,例如:1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p
+func (obj H2Fingerprint) String() string {
+	settings := make([]string, len(obj.Settings))
+	for i, setting := range obj.Settings {
+		settings[i] = fmt.Sprintf("%d:%d", setting.Id, setting.Val)
+	}
+	priorities := make([]string, len(obj.PriorityFrames))
+	for i, frame := range obj.PriorityFrames {
+		exclusive := 0
+		if frame.Priority.Exclusive {
+			exclusive = 1
+		}
+		priorities[i] = fmt.Sprintf("%d:%d:%d:%d", frame.StreamId, exclusive, frame.Priority.StreamDep, int(frame.Priority.Weight)+1)
+	}
+	priority := strings.Join(priorities, ",")
+	if priority == "" {
+		priority = "0"
+	}
+	headers := []string{}
+	for _, header := range obj.OrderHeaders {
+		if header = strings.TrimPrefix(header, ":"); header != "" {
+			headers = append(headers, header[:1])
+		}
+	}
+	return strings.Join([]string{strings.Join(settings, ";"), strconv.Itoa(int(obj.ConnFlow)), priority, strings.Join(headers, ",")}, "|")
+}
+
+// akamai 格式指纹的md5
+func (obj H2Fingerprint) Hash() string {
+	return tools.Hex(tools.Md5(obj.String()))
+}
+
+// 转换为客户端使用的http2 指纹
+func (obj H2Fingerprint) H2Ja3Spec() H2Ja3Spec {
+	return H2Ja3Spec{
+		InitialSetting: obj.Settings,
+		ConnFlow:       obj.ConnFlow,
+		OrderHeaders:   obj.OrderHeaders,
+		Priority:       obj.Priority,
+	}
+}
+
+var h2PseudoHeaders = map[string]string{
+	"m": ":method",
+	"a": ":authority",
+	"s": ":scheme",
+	"p": ":path",
+}
+
+// 解析akamai 格式的http2 指纹
+func ParseH2Fingerprint(str string) (H2Fingerprint, error) {
+	var fp H2Fingerprint
+	parts := strings.Split(strings.TrimSpace(str), "|")
+	if len(parts) != 4 {
+		return fp, errors.New("h2 指纹格式错误,需要4个部分")
+	}
+	if parts[0] != "" {
+		for _, setting := range strings.Split(parts[0], ";") {
+			kv := strings.Split(setting, ":")
+			if len(kv) != 2 {
+				return fp, errors.New("h2 指纹中settings 错误: " + setting)
+			}
+			id, err := strconv.ParseUint(kv[0], 10, 16)
+			if err != nil {
+				return fp, errors.New("h2 指纹中settings 错误: " + setting)
+			}
+			val, err := strconv.ParseUint(kv[1], 10, 32)
+			if err != nil {
+				return fp, errors.New("h2 指纹中settings 错误: " + setting)
+			}
+			fp.Settings = append(fp.Settings, Setting{Id: uint16(id), Val: uint32(val)})
+		}
+	}
+	connFlow, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return fp, errors.New("h2 指纹中window_update 错误: " + parts[1])
+	}
+	fp.ConnFlow = uint32(connFlow)
+	if parts[2] != "0" && parts[2] != "" {
+		for _, priority := range strings.Split(parts[2], ",") {
+			vals := strings.Split(priority, ":")
+			if len(vals) != 4 {
+				return fp, errors.New("h2 指纹中priority 错误: " + priority)
+			}
+			nums := make([]uint64, 4)
+			for i, val := range vals {
+				if nums[i], err = strconv.ParseUint(val, 10, 32); err != nil {
+					return fp, errors.New("h2 指纹中priority 错误: " + priority)
+				}
+			}
+			if nums[3] < 1 || nums[3] > 256 {
+				return fp, errors.New("h2 指纹中priority 错误: " + priority)
+			}
+			fp.PriorityFrames = append(fp.PriorityFrames, H2PriorityFrame{
+				StreamId: uint32(nums[0]),
+				Priority: Priority{
+					Exclusive: nums[1] == 1,
+					StreamDep: uint32(nums[2]),
+					Weight:    uint8(nums[3] - 1),
+				},
+			})
+		}
+	}
+	for _, header := range strings.Split(parts[3], ",") {
+		pseudo, ok := h2PseudoHeaders[header]
+		if !ok {
+			return fp, errors.New("h2 指纹中伪标头错误: " + header)
+		}
+		fp.OrderHeaders = append(fp.OrderHeaders, pseudo)
+	}
+	return fp, nil
+}
+
+// 使用akamai 格式的字符串生成http2 指纹,HEADERS 帧的优先级需要单独设置
+func CreateH2SpecWithStr(str string) (H2Ja3Spec, error) {
+	fp, err := ParseH2Fingerprint(str)
+	if err != nil {
+		return H2Ja3Spec{}, err
+	}
+	return fp.H2Ja3Spec(), nil
+}
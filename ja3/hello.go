@@ -0,0 +1,380 @@
+package ja3
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/justseemore/gospider/tools"
+)
+
+// client hello 中的扩展
+type HelloExtension struct {
+	Id   uint16 `json:"id"`
+	Name string `json:"name,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// 原始client hello 解析后的内容,保留grease 和扩展顺序
+type RawClientHello struct {
+	Raw                 []byte           `json:"-"` //handshake 消息,不包括record 头
+	Version             uint16           `json:"version"`
+	CipherSuites        []uint16         `json:"cipherSuites"`
+	CompressionMethods  []uint8          `json:"compressionMethods"`
+	Extensions          []HelloExtension `json:"extensions"`
+	ServerName          string           `json:"serverName,omitempty"`
+	SupportedCurves     []uint16         `json:"supportedCurves,omitempty"`
+	SupportedPoints     []uint8          `json:"supportedPoints,omitempty"`
+	SignatureAlgorithms []uint16         `json:"signatureAlgorithms,omitempty"`
+	SupportedVersions   []uint16         `json:"supportedVersions,omitempty"`
+	SupportedProtos     []string         `json:"supportedProtos,omitempty"`
+}
+
+type helloReader struct {
+	data []byte
+	err  bool
+}
+
+func (obj *helloReader) uint8() uint8 {
+	if len(obj.data) < 1 {
+		obj.err = true
+		return 0
+	}
+	val := obj.data[0]
+	obj.data = obj.data[1:]
+	return val
+}
+func (obj *helloReader) uint16() uint16 {
+	if len(obj.data) < 2 {
+		obj.err = true
+		return 0
+	}
+	val := binary.BigEndian.Uint16(obj.data)
+	obj.data = obj.data[2:]
+	return val
+}
+func (obj *helloReader) bytes(n int) []byte {
+	if len(obj.data) < n {
+		obj.err = true
+		return nil
+	}
+	val := obj.data[:n]
+	obj.data = obj.data[n:]
+	return val
+}
+func (obj *helloReader) vector8() *helloReader {
+	return &helloReader{data: obj.bytes(int(obj.uint8())), err: obj.err}
+}
+func (obj *helloReader) vector16() *helloReader {
+	return &helloReader{data: obj.bytes(int(obj.uint16())), err: obj.err}
+}
+func (obj *helloReader) uint16s() []uint16 {
+	vals := []uint16{}
+	for len(obj.data) >= 2 {
+		vals = append(vals, obj.uint16())
+	}
+	return vals
+}
+
+// 解析handshake 消息中的client hello
+func ParseClientHello(raw []byte) (*RawClientHello, error) {
+	reader := &helloReader{data: raw}
+	if reader.uint8() != 1 {
+		return nil, errors.New("不是client hello")
+	}
+	length := int(reader.uint8())<<16 | int(reader.uint16())
+	if reader.err || len(reader.data) < length {
+		return nil, errors.New("client hello 长度错误")
+	}
+	reader.data = reader.data[:length]
+	hello := &RawClientHello{Raw: raw[:length+4]}
+	hello.Version = reader.uint16()
+	reader.bytes(32) //random
+	reader.vector8() //session id
+	hello.CipherSuites = reader.vector16().uint16s()
+	hello.CompressionMethods = reader.vector8().data
+	if reader.err {
+		return nil, errors.New("client hello 格式错误")
+	}
+	extensions := reader.vector16()
+	for len(extensions.data) > 0 {
+		ext := HelloExtension{Id: extensions.uint16()}
+		ext.Data = extensions.vector16().data
+		if extensions.err {
+			return nil, errors.New("client hello 扩展格式错误")
+		}
+		if isGREASEUint16(ext.Id) {
+			ext.Name = "grease"
+		} else {
+			ext.Name = extensionNames[ext.Id]
+		}
+		hello.Extensions = append(hello.Extensions, ext)
+		data := &helloReader{data: ext.Data}
+		switch ext.Id {
+		case 0:
+			names := data.vector16()
+			for len(names.data) > 0 && !names.err {
+				nameType := names.uint8()
+				name := names.vector16().data
+				if nameType == 0 {
+					hello.ServerName = string(name)
+				}
+			}
+		case 10:
+			hello.SupportedCurves = data.vector16().uint16s()
+		case 11:
+			hello.SupportedPoints = data.vector8().data
+		case 13:
+			hello.SignatureAlgorithms = data.vector16().uint16s()
+		case 16:
+			protos := data.vector16()
+			for len(protos.data) > 0 && !protos.err {
+				hello.SupportedProtos = append(hello.SupportedProtos, string(protos.vector8().data))
+			}
+		case 43:
+			hello.SupportedVersions = data.vector8().uint16s()
+		}
+	}
+	return hello, nil
+}
+
+func joinUint16(vals []uint16, sep string, format func(uint16) string) string {
+	strs := []string{}
+	for _, val := range vals {
+		if !isGREASEUint16(val) {
+			strs = append(strs, format(val))
+		}
+	}
+	return strings.Join(strs, sep)
+}
+func decUint16(val uint16) string {
+	return strconv.Itoa(int(val))
+}
+func hexUint16(val uint16) string {
+	return fmt.Sprintf("%04x", val)
+}
+
+// 扩展id 列表,包括grease
+func (obj *RawClientHello) ExtensionIds() []uint16 {
+	ids := make([]uint16, len(obj.Extensions))
+	for i, ext := range obj.Extensions {
+		ids[i] = ext.Id
+	}
+	return ids
+}
+func (obj *RawClientHello) ja3(extensions []uint16) string {
+	points := make([]uint16, len(obj.SupportedPoints))
+	for i, point := range obj.SupportedPoints {
+		points[i] = uint16(point)
+	}
+	return strings.Join([]string{
+		decUint16(obj.Version),
+		joinUint16(obj.CipherSuites, "-", decUint16),
+		joinUint16(extensions, "-", decUint16),
+		joinUint16(obj.SupportedCurves, "-", decUint16),
+		joinUint16(points, "-", decUint16),
+	}, ",")
+}
+
+// 标准的ja3 字符串
+func (obj *RawClientHello) Ja3() string {
+	return obj.ja3(obj.ExtensionIds())
+}
+
+// 标准的ja3 的md5
+func (obj *RawClientHello) Ja3Hash() string {
+	return tools.Hex(tools.Md5(obj.Ja3()))
+}
+
+// 扩展排序后的ja3,不受chrome 扩展随机顺序的影响
+func (obj *RawClientHello) Ja3n() string {
+	extensions := obj.ExtensionIds()
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i] < extensions[j] })
+	return obj.ja3(extensions)
+}
+
+// ja3n 的md5
+func (obj *RawClientHello) Ja3nHash() string {
+	return tools.Hex(tools.Md5(obj.Ja3n()))
+}
+
+func ja4Hash(val string) string {
+	if val == "" {
+		return "000000000000"
+	}
+	hash := sha256.Sum256([]byte(val))
+	return hex.EncodeToString(hash[:])[:12]
+}
+func ja4Count(vals []uint16) string {
+	count := 0
+	for _, val := range vals {
+		if !isGREASEUint16(val) {
+			count++
+		}
+	}
+	if count > 99 {
+		count = 99
+	}
+	return fmt.Sprintf("%02d", count)
+}
+func isAlnum(val byte) bool {
+	return (val >= '0' && val <= '9') || (val >= 'a' && val <= 'z') || (val >= 'A' && val <= 'Z')
+}
+
+// ja4 指纹,https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+func (obj *RawClientHello) Ja4() string {
+	version := obj.Version
+	for _, ver := range obj.SupportedVersions {
+		if !isGREASEUint16(ver) && ver > version {
+			version = ver
+		}
+	}
+	var ja4a strings.Builder
+	ja4a.WriteString("t")
+	switch version {
+	case 0x0304:
+		ja4a.WriteString("13")
+	case 0x0303:
+		ja4a.WriteString("12")
+	case 0x0302:
+		ja4a.WriteString("11")
+	case 0x0301:
+		ja4a.WriteString("10")
+	case 0x0300:
+		ja4a.WriteString("s3")
+	default:
+		ja4a.WriteString("00")
+	}
+	if obj.ServerName != "" {
+		ja4a.WriteString("d")
+	} else {
+		ja4a.WriteString("i")
+	}
+	extensions := obj.ExtensionIds()
+	ja4a.WriteString(ja4Count(obj.CipherSuites))
+	ja4a.WriteString(ja4Count(extensions))
+	if len(obj.SupportedProtos) == 0 || obj.SupportedProtos[0] == "" {
+		ja4a.WriteString("00")
+	} else if proto := obj.SupportedProtos[0]; isAlnum(proto[0]) && isAlnum(proto[len(proto)-1]) {
+		ja4a.WriteByte(proto[0])
+		ja4a.WriteByte(proto[len(proto)-1])
+	} else {
+		protoHex := hex.EncodeToString([]byte(proto))
+		ja4a.WriteByte(protoHex[0])
+		ja4a.WriteByte(protoHex[len(protoHex)-1])
+	}
+	ciphers := slicesSorted(obj.CipherSuites)
+	var exts []uint16
+	for _, ext := range slicesSorted(extensions) {
+		if ext != 0 && ext != 16 {
+			exts = append(exts, ext)
+		}
+	}
+	ja4c := joinUint16(exts, ",", hexUint16)
+	if ja4c != "" && len(obj.SignatureAlgorithms) > 0 {
+		ja4c += "_" + joinUint16(obj.SignatureAlgorithms, ",", hexUint16)
+	}
+	return ja4a.String() + "_" + ja4Hash(joinUint16(ciphers, ",", hexUint16)) + "_" + ja4Hash(ja4c)
+}
+func slicesSorted(vals []uint16) []uint16 {
+	result := append([]uint16{}, vals...)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// 记录客户端发送的client hello,需要在crypto/tls 之前读取
+type helloConn struct {
+	net.Conn
+	lock  sync.Mutex
+	buf   []byte
+	done  bool
+	hello *RawClientHello
+}
+
+func (obj *helloConn) Read(b []byte) (int, error) {
+	n, err := obj.Conn.Read(b)
+	if n > 0 {
+		obj.lock.Lock()
+		if !obj.done {
+			obj.buf = append(obj.buf, b[:n]...)
+			obj.parse()
+		}
+		obj.lock.Unlock()
+	}
+	return n, err
+}
+
+// 从record 中取出完整的handshake 消息后解析,client hello 可能分布在多个record 中
+func (obj *helloConn) parse() {
+	var handshake []byte
+	data := obj.buf
+	for len(data) >= 5 {
+		if data[0] != 22 { //不是handshake
+			obj.done = true
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+length {
+			return
+		}
+		handshake = append(handshake, data[5:5+length]...)
+		data = data[5+length:]
+		if len(handshake) >= 4 && len(handshake) >= 4+(int(handshake[1])<<16|int(handshake[2])<<8|int(handshake[3])) {
+			obj.done = true
+			obj.hello, _ = ParseClientHello(handshake)
+			break
+		}
+	}
+	if obj.done {
+		obj.buf = nil
+	}
+}
+
+// 返回客户端发送的client hello,握手前为nil
+func (obj *helloConn) ClientHello() *RawClientHello {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	return obj.hello
+}
+
+type helloListener struct {
+	net.Listener
+}
+
+func (obj helloListener) Accept() (net.Conn, error) {
+	conn, err := obj.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	return &helloConn{Conn: conn}, nil
+}
+
+// 包装listener,记录原始client hello,用于计算ja3,ja3n,ja4
+//
+//	ln = ja3.NewListener(ln)
+//	server.ServeTLS(ln, "", "")
+func NewListener(ln net.Listener) net.Listener {
+	return helloListener{Listener: ln}
+}
+
+// 从连接中获取原始client hello,连接需要由NewListener 生成
+func GetClientHello(conn net.Conn) *RawClientHello {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *helloConn:
+			return c.ClientHello()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -640,24 +640,6 @@ type ClientHello struct {
 	SignatureSchemes []tls.SignatureScheme //列出了客户端愿意验证的签名和散列方案[ECDSAWithP256AndSHA256 PSSWithSHA256 PKCS1WithSHA256 ECDSAWithP384AndSHA384 PSSWithSHA384 PKCS1WithSHA384 PSSWithSHA512 PKCS1WithSHA512]
 }
 
-var ja3Db = map[string]string{
-	"41c1a0a0b7fea468f579fe3100c6d48a": "Firefox",
-	"149e406721fa906e06d7f44589139e0e": "Firefox",
-	"e92a163261a4777ba6ae540f587468ea": "Firefox",
-	"ff5fb9c500cb93592dc619b21746d610": "Firefox",
-	"88bd3cb92eb400fabc11d5c7ef336658": "Chrome",
-	"43818547191c95092fd5c7145d07ca33": "Chrome",
-	"4297e191aadbb83bcca9ad0a824c5d18": "Chrome",
-	"ebcb348cdbaaf5e7a47b197bb9b1255f": "Chrome",
-	"2a5649bb0a3c364491777ddf2678b396": "iOS",
-	"2dcb3f02b926b086a068d10db1c5ea63": "iOS",
-	"7e8d9723c8236b9e159d2310c574054f": "iOS",
-	"0062ef304d078cdf567bbe32349fd446": "iOS",
-	"811b5bb18faa39a6927a393b4a084249": "Android",
-	"3a2220ccf3b251502c646249252d8fe5": "Safari",
-	"e58713f1e65a280ce3bec3b85e6a3485": "360Browser",
-}
-
 func newClientHello(chi *tls.ClientHelloInfo) ClientHello {
 	if chi.SupportedCurves[0] != tls.X25519 {
 		chi.SupportedCurves = chi.SupportedCurves[1:]
@@ -687,8 +669,9 @@ func newClientHello(chi *tls.ClientHelloInfo) ClientHello {
 }
 
 type Ja3ContextData struct {
-	ClientHello ClientHello `json:"clientHello"`
-	Init        bool        `json:"init"`
+	ClientHello ClientHello     `json:"clientHello"`
+	Hello       *RawClientHello `json:"hello,omitempty"` //原始client hello,listener 需要使用NewListener 包装
+	Init        bool            `json:"init"`
 }
 
 func (obj Ja3ContextData) Md5() string {
@@ -711,12 +694,37 @@ func (obj Ja3ContextData) Md5() string {
 	return tools.Hex(tools.Md5(md5Str))
 }
 
+// 加载json 或csv 格式的指纹库到默认的指纹库,详见Db.Load
+func LoadDb(path string) error {
+	return defaultDb.Load(path)
+}
+
+// 在默认的指纹库中查询指纹,返回名称
 func VerifyWithMd5(md string) (string, bool) {
-	ja3Name, ja3Ok := ja3Db[md]
-	return ja3Name, ja3Ok
+	entry, ok := defaultDb.Lookup(md)
+	return entry.Name(), ok
 }
+
+// 在指纹库中依次使用ja3,ja3n,ja4,md5 查询,有原始client hello 时才会使用ja3,ja3n,ja4
+func (obj Ja3ContextData) Lookup(db *Db) (DbEntry, bool) {
+	if obj.Hello != nil {
+		if entry, ok := db.Lookup(obj.Hello.Ja3Hash(), DbTypeJa3); ok {
+			return entry, ok
+		}
+		if entry, ok := db.Lookup(obj.Hello.Ja3nHash(), DbTypeJa3n); ok {
+			return entry, ok
+		}
+		if entry, ok := db.Lookup(obj.Hello.Ja4(), DbTypeJa4); ok {
+			return entry, ok
+		}
+	}
+	return db.Lookup(obj.Md5(), DbTypeMd5)
+}
+
+// 在默认的指纹库中查询,返回名称
 func (obj Ja3ContextData) Verify() (string, bool) {
-	return VerifyWithMd5(obj.Md5())
+	entry, ok := obj.Lookup(defaultDb)
+	return entry.Name(), ok
 }
 
 type keyPrincipal string
@@ -727,7 +735,9 @@ func ConnContext(ctx context.Context, c net.Conn) context.Context {
 	return context.WithValue(ctx, keyPrincipalID, &Ja3ContextData{})
 }
 func GetConfigForClient(chi *tls.ClientHelloInfo) (*tls.Config, error) {
-	chi.Context().Value(keyPrincipalID).(*Ja3ContextData).ClientHello = newClientHello(chi)
+	data := chi.Context().Value(keyPrincipalID).(*Ja3ContextData)
+	data.ClientHello = newClientHello(chi)
+	data.Hello = GetClientHello(chi.Conn)
 	return nil, nil
 }
 func GetRequestJa3Data(r *http.Request) *Ja3ContextData {
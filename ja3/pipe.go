@@ -22,8 +22,8 @@ type Conn struct {
 	ctx     context.Context
 	cnl     context.CancelFunc
 
-	readTimer   time.Timer
-	writerTimer time.Timer
+	readTimer   *time.Timer
+	writerTimer *time.Timer
 }
 type Addr struct{}
 
@@ -102,14 +102,27 @@ func (obj *Conn) SetDeadline(t time.Time) error {
 	return nil
 }
 func (obj *Conn) SetReadDeadline(t time.Time) error {
-	obj.readTimer.Reset(time.Now().Sub(t))
+	resetTimer(obj.readTimer, t)
 	return nil
 }
 func (obj *Conn) SetWriteDeadline(t time.Time) error {
-	obj.writerTimer.Reset(time.Now().Sub(t))
+	resetTimer(obj.writerTimer, t)
 	return nil
 }
 
+// 重置超时时间,时间为零值时取消超时
+func resetTimer(timer *time.Timer, t time.Time) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	if !t.IsZero() {
+		timer.Reset(time.Until(t))
+	}
+}
+
 func Pipe(preCtx context.Context) (net.Conn, net.Conn) {
 	ctx, cnl := context.WithCancel(preCtx)
 	readerCha := make(chan []byte)
@@ -124,8 +137,8 @@ func Pipe(preCtx context.Context) (net.Conn, net.Conn) {
 		writerI:     writerI,
 		ctx:         ctx,
 		cnl:         cnl,
-		readTimer:   *time.NewTimer(time.Hour * 24 * 365 * 100),
-		writerTimer: *time.NewTimer(time.Hour * 24 * 365 * 100),
+		readTimer:   time.NewTimer(time.Hour * 24 * 365 * 100),
+		writerTimer: time.NewTimer(time.Hour * 24 * 365 * 100),
 	}
 	remoteConn := &Conn{
 		reader:      writerCha,
@@ -134,8 +147,8 @@ func Pipe(preCtx context.Context) (net.Conn, net.Conn) {
 		writerI:     readerI,
 		ctx:         ctx,
 		cnl:         cnl,
-		readTimer:   *time.NewTimer(time.Hour * 24 * 365 * 100),
-		writerTimer: *time.NewTimer(time.Hour * 24 * 365 * 100),
+		readTimer:   time.NewTimer(time.Hour * 24 * 365 * 100),
+		writerTimer: time.NewTimer(time.Hour * 24 * 365 * 100),
 	}
 	return localConn, remoteConn
 }
@@ -0,0 +1,431 @@
+package ja3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// 扩展的名称,用于json 中方便阅读和对比
+var extensionNames = map[uint16]string{
+	0:      "server_name",
+	5:      "status_request",
+	10:     "supported_groups",
+	11:     "ec_point_formats",
+	13:     "signature_algorithms",
+	16:     "application_layer_protocol_negotiation",
+	17:     "status_request_v2",
+	18:     "signed_certificate_timestamp",
+	21:     "padding",
+	23:     "extended_master_secret",
+	24:     "token_binding",
+	27:     "compress_certificate",
+	28:     "record_size_limit",
+	34:     "delegated_credentials",
+	35:     "session_ticket",
+	41:     "pre_shared_key",
+	43:     "supported_versions",
+	44:     "cookie",
+	45:     "psk_key_exchange_modes",
+	50:     "signature_algorithms_cert",
+	51:     "key_share",
+	57:     "quic_transport_parameters",
+	13172:  "next_protocol_negotiation",
+	17513:  "application_settings",
+	30031:  "channel_id_old",
+	30032:  "channel_id",
+	0xff01: "renegotiation_info",
+}
+
+// 返回扩展的id
+func ExtensionId(extension utls.TLSExtension) (uint16, bool) {
+	switch ext := extension.(type) {
+	case *utls.SNIExtension:
+		return 0, true
+	case *utls.StatusRequestExtension:
+		return 5, true
+	case *utls.SupportedCurvesExtension:
+		return 10, true
+	case *utls.SupportedPointsExtension:
+		return 11, true
+	case *utls.SignatureAlgorithmsExtension:
+		return 13, true
+	case *utls.ALPNExtension:
+		return 16, true
+	case *utls.StatusRequestV2Extension:
+		return 17, true
+	case *utls.SCTExtension:
+		return 18, true
+	case *utls.UtlsPaddingExtension:
+		return 21, true
+	case *utls.ExtendedMasterSecretExtension:
+		return 23, true
+	case *utls.FakeTokenBindingExtension:
+		return 24, true
+	case *utls.UtlsCompressCertExtension:
+		return 27, true
+	case *utls.FakeRecordSizeLimitExtension:
+		return 28, true
+	case *utls.FakeDelegatedCredentialsExtension:
+		return 34, true
+	case *utls.SessionTicketExtension:
+		return 35, true
+	case *utls.UtlsPreSharedKeyExtension:
+		return 41, true
+	case *utls.SupportedVersionsExtension:
+		return 43, true
+	case *utls.CookieExtension:
+		return 44, true
+	case *utls.PSKKeyExchangeModesExtension:
+		return 45, true
+	case *utls.SignatureAlgorithmsCertExtension:
+		return 50, true
+	case *utls.KeyShareExtension:
+		return 51, true
+	case *utls.QUICTransportParametersExtension:
+		return 57, true
+	case *utls.NPNExtension:
+		return 13172, true
+	case *utls.ApplicationSettingsExtension:
+		return 17513, true
+	case *utls.FakeChannelIDExtension:
+		if ext.OldExtensionID {
+			return 30031, true
+		}
+		return 30032, true
+	case *utls.RenegotiationInfoExtension:
+		return 0xff01, true
+	case *utls.UtlsGREASEExtension:
+		return ext.Value, true
+	case *utls.GenericExtension:
+		return ext.Id, true
+	default:
+		return 0, false
+	}
+}
+
+// 标准的ja3 字符串,去掉grease,版本为client hello 中的版本
+func (obj Ja3Spec) String() string {
+	join := func(vals []uint16) string {
+		strs := []string{}
+		for _, val := range vals {
+			if !isGREASEUint16(val) {
+				strs = append(strs, strconv.Itoa(int(val)))
+			}
+		}
+		return strings.Join(strs, "-")
+	}
+	var extensions, curves, points []uint16
+	for _, extension := range obj.Extensions {
+		switch ext := extension.(type) {
+		case *utls.UtlsGREASEExtension:
+		case *utls.SupportedCurvesExtension:
+			extensions = append(extensions, 10)
+			for _, curve := range ext.Curves {
+				curves = append(curves, uint16(curve))
+			}
+		case *utls.SupportedPointsExtension:
+			extensions = append(extensions, 11)
+			for _, point := range ext.SupportedPoints {
+				points = append(points, uint16(point))
+			}
+		default:
+			if id, ok := ExtensionId(extension); ok {
+				extensions = append(extensions, id)
+			}
+		}
+	}
+	version := obj.TLSVersMax
+	if version == 0 { //没有设置时由supported_versions 决定
+		version = utls.VersionTLS12
+		for _, extension := range obj.Extensions {
+			if ext, ok := extension.(*utls.SupportedVersionsExtension); ok {
+				for _, ver := range ext.Versions {
+					if !isGREASEUint16(ver) && ver > version {
+						version = ver
+					}
+				}
+			}
+		}
+	}
+	if version > utls.VersionTLS12 { //tls1.3 的client hello 版本为tls1.2
+		version = utls.VersionTLS12
+	}
+	return fmt.Sprintf("%d,%s,%s,%s,%s", version, join(obj.CipherSuites), join(extensions), join(curves), join(points))
+}
+
+// ja3 字符串的md5
+func (obj Ja3Spec) Hash() string {
+	hash := md5.Sum([]byte(obj.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+type ja3SpecJson struct {
+	TLSVersMin         uint16          `json:"tlsVersMin"`
+	TLSVersMax         uint16          `json:"tlsVersMax"`
+	CipherSuites       []uint16        `json:"cipherSuites"`
+	CompressionMethods []int           `json:"compressionMethods"`
+	Extensions         []extensionJson `json:"extensions"`
+}
+type keyShareJson struct {
+	Group uint16 `json:"group"`
+	Data  []byte `json:"data,omitempty"`
+}
+type extensionJson struct {
+	Id                  uint16         `json:"id"`
+	Name                string         `json:"name,omitempty"`
+	Grease              bool           `json:"grease,omitempty"`
+	Data                []byte         `json:"data,omitempty"` //grease,cookie,session_ticket 和未知扩展的内容
+	ServerName          string         `json:"serverName,omitempty"`
+	Curves              []uint16       `json:"curves,omitempty"`
+	Points              []int          `json:"points,omitempty"`
+	SignatureAlgorithms []uint16       `json:"signatureAlgorithms,omitempty"`
+	Protocols           []string       `json:"protocols,omitempty"` //alpn,alps,npn
+	KeyShares           []keyShareJson `json:"keyShares,omitempty"`
+	Versions            []uint16       `json:"versions,omitempty"`
+	Modes               []int          `json:"modes,omitempty"`
+	Algorithms          []uint16       `json:"algorithms,omitempty"`
+	Padding             string         `json:"padding,omitempty"` //boring:使用BoringPaddingStyle 计算长度
+	PaddingLen          int            `json:"paddingLen,omitempty"`
+	WillPad             bool           `json:"willPad,omitempty"`
+	Limit               uint16         `json:"limit,omitempty"`
+	MajorVersion        uint8          `json:"majorVersion,omitempty"`
+	MinorVersion        uint8          `json:"minorVersion,omitempty"`
+	KeyParameters       []int          `json:"keyParameters,omitempty"`
+	Renegotiation       int            `json:"renegotiation,omitempty"`
+}
+
+func uint16s[T ~uint16](vals []T) []uint16 {
+	if vals == nil {
+		return nil
+	}
+	result := make([]uint16, len(vals))
+	for i, val := range vals {
+		result[i] = uint16(val)
+	}
+	return result
+}
+func fromUint16s[T ~uint16](vals []uint16) []T {
+	if vals == nil {
+		return nil
+	}
+	result := make([]T, len(vals))
+	for i, val := range vals {
+		result[i] = T(val)
+	}
+	return result
+}
+func ints(vals []uint8) []int {
+	if vals == nil {
+		return nil
+	}
+	result := make([]int, len(vals))
+	for i, val := range vals {
+		result[i] = int(val)
+	}
+	return result
+}
+func fromInts(vals []int) []uint8 {
+	if vals == nil {
+		return nil
+	}
+	result := make([]uint8, len(vals))
+	for i, val := range vals {
+		result[i] = uint8(val)
+	}
+	return result
+}
+
+// 扩展转换为json 结构
+func newExtensionJson(extension utls.TLSExtension) (extensionJson, error) {
+	id, ok := ExtensionId(extension)
+	if !ok { //未知的扩展,读取原始内容
+		con := make([]byte, extension.Len())
+		if extension.Read(con); len(con) < 4 {
+			return extensionJson{}, fmt.Errorf("不支持的扩展: %T", extension)
+		}
+		id = uint16(con[0])<<8 | uint16(con[1])
+		extension = &utls.GenericExtension{Id: id, Data: con[4:]}
+	}
+	result := extensionJson{Id: id, Name: extensionNames[id]}
+	switch ext := extension.(type) {
+	case *utls.UtlsGREASEExtension:
+		result.Name = "grease"
+		result.Grease = true
+		result.Data = ext.Body
+	case *utls.GenericExtension:
+		result.Data = ext.Data
+	case *utls.SNIExtension:
+		result.ServerName = ext.ServerName
+	case *utls.SupportedCurvesExtension:
+		result.Curves = uint16s(ext.Curves)
+	case *utls.SupportedPointsExtension:
+		result.Points = ints(ext.SupportedPoints)
+	case *utls.SignatureAlgorithmsExtension:
+		result.SignatureAlgorithms = uint16s(ext.SupportedSignatureAlgorithms)
+	case *utls.SignatureAlgorithmsCertExtension:
+		result.SignatureAlgorithms = uint16s(ext.SupportedSignatureAlgorithms)
+	case *utls.FakeDelegatedCredentialsExtension:
+		result.SignatureAlgorithms = uint16s(ext.SupportedSignatureAlgorithms)
+	case *utls.ALPNExtension:
+		result.Protocols = ext.AlpnProtocols
+	case *utls.ApplicationSettingsExtension:
+		result.Protocols = ext.SupportedProtocols
+	case *utls.NPNExtension:
+		result.Protocols = ext.NextProtos
+	case *utls.KeyShareExtension:
+		for _, keyShare := range ext.KeyShares {
+			result.KeyShares = append(result.KeyShares, keyShareJson{Group: uint16(keyShare.Group), Data: keyShare.Data})
+		}
+	case *utls.SupportedVersionsExtension:
+		result.Versions = ext.Versions
+	case *utls.PSKKeyExchangeModesExtension:
+		result.Modes = ints(ext.Modes)
+	case *utls.UtlsCompressCertExtension:
+		result.Algorithms = uint16s(ext.Algorithms)
+	case *utls.UtlsPaddingExtension:
+		if ext.GetPaddingLen != nil {
+			result.Padding = "boring"
+		}
+		result.PaddingLen = ext.PaddingLen
+		result.WillPad = ext.WillPad
+	case *utls.FakeRecordSizeLimitExtension:
+		result.Limit = ext.Limit
+	case *utls.FakeTokenBindingExtension:
+		result.MajorVersion = ext.MajorVersion
+		result.MinorVersion = ext.MinorVersion
+		result.KeyParameters = ints(ext.KeyParameters)
+	case *utls.CookieExtension:
+		result.Data = ext.Cookie
+	case *utls.SessionTicketExtension:
+		result.Data = ext.Ticket
+	case *utls.RenegotiationInfoExtension:
+		result.Renegotiation = int(ext.Renegotiation)
+	}
+	return result, nil
+}
+
+// json 结构转换为扩展
+func (obj extensionJson) extension() (utls.TLSExtension, error) {
+	if obj.Grease || isGREASEUint16(obj.Id) {
+		return &utls.UtlsGREASEExtension{Value: obj.Id, Body: obj.Data}, nil
+	}
+	switch obj.Id {
+	case 0:
+		return &utls.SNIExtension{ServerName: obj.ServerName}, nil
+	case 5:
+		return &utls.StatusRequestExtension{}, nil
+	case 10:
+		return &utls.SupportedCurvesExtension{Curves: fromUint16s[utls.CurveID](obj.Curves)}, nil
+	case 11:
+		return &utls.SupportedPointsExtension{SupportedPoints: fromInts(obj.Points)}, nil
+	case 13:
+		return &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: fromUint16s[utls.SignatureScheme](obj.SignatureAlgorithms)}, nil
+	case 16:
+		return &utls.ALPNExtension{AlpnProtocols: obj.Protocols}, nil
+	case 17:
+		return &utls.StatusRequestV2Extension{}, nil
+	case 18:
+		return &utls.SCTExtension{}, nil
+	case 21:
+		ext := &utls.UtlsPaddingExtension{PaddingLen: obj.PaddingLen, WillPad: obj.WillPad}
+		if obj.Padding == "boring" {
+			ext.GetPaddingLen = utls.BoringPaddingStyle
+		}
+		return ext, nil
+	case 23:
+		return &utls.ExtendedMasterSecretExtension{}, nil
+	case 24:
+		return &utls.FakeTokenBindingExtension{MajorVersion: obj.MajorVersion, MinorVersion: obj.MinorVersion, KeyParameters: fromInts(obj.KeyParameters)}, nil
+	case 27:
+		return &utls.UtlsCompressCertExtension{Algorithms: fromUint16s[utls.CertCompressionAlgo](obj.Algorithms)}, nil
+	case 28:
+		return &utls.FakeRecordSizeLimitExtension{Limit: obj.Limit}, nil
+	case 34:
+		return &utls.FakeDelegatedCredentialsExtension{SupportedSignatureAlgorithms: fromUint16s[utls.SignatureScheme](obj.SignatureAlgorithms)}, nil
+	case 35:
+		return &utls.SessionTicketExtension{Ticket: obj.Data}, nil
+	case 41:
+		return &utls.UtlsPreSharedKeyExtension{}, nil
+	case 43:
+		return &utls.SupportedVersionsExtension{Versions: obj.Versions}, nil
+	case 44:
+		return &utls.CookieExtension{Cookie: obj.Data}, nil
+	case 45:
+		return &utls.PSKKeyExchangeModesExtension{Modes: fromInts(obj.Modes)}, nil
+	case 50:
+		return &utls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: fromUint16s[utls.SignatureScheme](obj.SignatureAlgorithms)}, nil
+	case 51:
+		ext := &utls.KeyShareExtension{}
+		for _, keyShare := range obj.KeyShares {
+			ext.KeyShares = append(ext.KeyShares, utls.KeyShare{Group: utls.CurveID(keyShare.Group), Data: keyShare.Data})
+		}
+		return ext, nil
+	case 57:
+		return &utls.QUICTransportParametersExtension{}, nil
+	case 13172:
+		return &utls.NPNExtension{NextProtos: obj.Protocols}, nil
+	case 17513:
+		return &utls.ApplicationSettingsExtension{SupportedProtocols: obj.Protocols}, nil
+	case 30031:
+		return &utls.FakeChannelIDExtension{OldExtensionID: true}, nil
+	case 30032:
+		return &utls.FakeChannelIDExtension{}, nil
+	case 0xff01:
+		return &utls.RenegotiationInfoExtension{Renegotiation: utls.RenegotiationSupport(obj.Renegotiation)}, nil
+	default:
+		return &utls.GenericExtension{Id: obj.Id, Data: obj.Data}, nil
+	}
+}
+
+// 转换为json,包括扩展的参数,可以通过UnmarshalJSON 还原
+func (obj Ja3Spec) MarshalJSON() ([]byte, error) {
+	result := ja3SpecJson{
+		TLSVersMin:         obj.TLSVersMin,
+		TLSVersMax:         obj.TLSVersMax,
+		CipherSuites:       obj.CipherSuites,
+		CompressionMethods: ints(obj.CompressionMethods),
+		Extensions:         make([]extensionJson, len(obj.Extensions)),
+	}
+	for i, extension := range obj.Extensions {
+		ext, err := newExtensionJson(extension)
+		if err != nil {
+			return nil, err
+		}
+		result.Extensions[i] = ext
+	}
+	return json.Marshal(result)
+}
+
+// 从MarshalJSON 生成的json 还原
+func (obj *Ja3Spec) UnmarshalJSON(con []byte) error {
+	var result ja3SpecJson
+	if err := json.Unmarshal(con, &result); err != nil {
+		return err
+	}
+	if len(result.CipherSuites) == 0 {
+		return errors.New("ja3Spec json 中没有cipherSuites")
+	}
+	spec := Ja3Spec{
+		TLSVersMin:         result.TLSVersMin,
+		TLSVersMax:         result.TLSVersMax,
+		CipherSuites:       result.CipherSuites,
+		CompressionMethods: fromInts(result.CompressionMethods),
+		Extensions:         make([]utls.TLSExtension, len(result.Extensions)),
+	}
+	for i, ext := range result.Extensions {
+		extension, err := ext.extension()
+		if err != nil {
+			return err
+		}
+		spec.Extensions[i] = extension
+	}
+	*obj = spec
+	return nil
+}
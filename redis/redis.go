@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/justseemore/gospider/tools"
@@ -41,6 +42,21 @@ func NewClient(option ClientOption) (*Client, error) {
 	return &Client{object: redCli, proxys: make(map[string][]string)}, err
 }
 
+// 获取key的值
+func (r *Client) Get(name string) (string, error) {
+	return r.object.Get(name).Result()
+}
+
+// 设置key的值,expiration 为0 表示永不过期
+func (r *Client) Set(name string, val any, expiration time.Duration) error {
+	return r.object.Set(name, val, expiration).Err()
+}
+
+// 删除key
+func (r *Client) Del(names ...string) (int64, error) {
+	return r.object.Del(names...).Result()
+}
+
 // 集合增加元素
 func (r *Client) SAdd(name string, vals ...any) (int64, error) {
 	return r.object.SAdd(name, vals...).Result()
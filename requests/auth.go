@@ -0,0 +1,508 @@
+package requests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justseemore/gospider/tools"
+	"github.com/tidwall/gjson"
+)
+
+// 认证,在transport 中执行,可以修改最终的headers 和读取body
+type Auth interface {
+	//发送请求前调用,修改请求的headers
+	Sign(req *http.Request) error
+	//收到response 后调用,返回true 时重新签名并发送一次请求
+	Challenge(req *http.Request, resp *http.Response) (bool, error)
+}
+
+type authRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (obj *authRoundTripper) CloseIdleConnections() {
+	if closeIdler, ok := obj.next.(interface{ CloseIdleConnections() }); ok {
+		closeIdler.CloseIdleConnections()
+	}
+}
+func (obj *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctxData := req.Context().Value(keyPrincipalID).(*reqCtxData)
+	if ctxData.auth == nil {
+		return obj.next.RoundTrip(req)
+	}
+	if ctxData.authHost == "" {
+		ctxData.authHost = req.URL.Host
+	} else if ctxData.authHost != req.URL.Host { //重定向到其它host 时不发送认证信息
+		return obj.next.RoundTrip(req)
+	}
+	signReq := req.Clone(req.Context())
+	if err := ctxData.auth.Sign(signReq); err != nil {
+		return nil, tools.WrapError(err, "auth Sign 错误")
+	}
+	resp, err := obj.next.RoundTrip(signReq)
+	if err != nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, err
+	}
+	retry, err := ctxData.auth.Challenge(signReq, resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, tools.WrapError(err, "auth Challenge 错误")
+	}
+	if !retry || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) { //body 无法重复读取时不能重新发送
+		return resp, nil
+	}
+	retryReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retryReq.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	tools.CopyWitchContext(req.Context(), io.Discard, resp.Body)
+	resp.Body.Close()
+	if err = ctxData.auth.Sign(retryReq); err != nil {
+		return nil, tools.WrapError(err, "auth Sign 错误")
+	}
+	return obj.next.RoundTrip(retryReq)
+}
+
+// 解析WWW-Authenticate 中的参数
+func parseAuthParams(val string) map[string]string {
+	params := map[string]string{}
+	for val = strings.TrimSpace(val); val != ""; {
+		key, rest, ok := strings.Cut(val, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimSpace(rest)
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var builder strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				builder.WriteByte(rest[i])
+			}
+			value, rest = builder.String(), rest[min(i+1, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+			rest = "," + rest
+		}
+		params[key] = value
+		_, val, _ = strings.Cut(rest, ",")
+		val = strings.TrimSpace(val)
+	}
+	return params
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	nc        int64
+}
+type digestAuth struct {
+	usr        string
+	pwd        string
+	challenges map[string]*digestChallenge
+	lock       sync.Mutex
+}
+
+// http digest 认证,收到401 后根据challenge 重新发送,之后同一个host 的请求直接携带认证
+func NewDigestAuth(usr, pwd string) Auth {
+	return &digestAuth{
+		usr:        usr,
+		pwd:        pwd,
+		challenges: make(map[string]*digestChallenge),
+	}
+}
+func (obj *digestAuth) hash(algorithm string, val string) string {
+	var hasher hash.Hash
+	if strings.HasPrefix(strings.ToUpper(algorithm), "SHA-256") {
+		hasher = sha256.New()
+	} else {
+		hasher = md5.New()
+	}
+	hasher.Write(tools.StringToBytes(val))
+	return tools.Hex(hasher.Sum(nil))
+}
+func (obj *digestAuth) Sign(req *http.Request) error {
+	obj.lock.Lock()
+	challenge, ok := obj.challenges[req.URL.Host]
+	if !ok {
+		obj.lock.Unlock()
+		return nil
+	}
+	challenge.nc++
+	nc := challenge.nc
+	chal := *challenge
+	obj.lock.Unlock()
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return err
+	}
+	cnonce := tools.Hex(cnonceBytes)
+	uri := req.URL.RequestURI()
+	ha1 := obj.hash(chal.algorithm, fmt.Sprintf("%s:%s:%s", obj.usr, chal.realm, obj.pwd))
+	if strings.HasSuffix(strings.ToLower(chal.algorithm), "-sess") {
+		ha1 = obj.hash(chal.algorithm, fmt.Sprintf("%s:%s:%s", ha1, chal.nonce, cnonce))
+	}
+	ha2 := obj.hash(chal.algorithm, fmt.Sprintf("%s:%s", req.Method, uri))
+	var response string
+	if chal.qop != "" {
+		response = obj.hash(chal.algorithm, fmt.Sprintf("%s:%s:%08x:%s:%s:%s", ha1, chal.nonce, nc, cnonce, chal.qop, ha2))
+	} else {
+		response = obj.hash(chal.algorithm, fmt.Sprintf("%s:%s:%s", ha1, chal.nonce, ha2))
+	}
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		escapeQuotes.Replace(obj.usr), escapeQuotes.Replace(chal.realm), chal.nonce, uri, response)
+	if chal.algorithm != "" {
+		auth += ", algorithm=" + chal.algorithm
+	}
+	if chal.opaque != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, chal.opaque)
+	}
+	if chal.qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%08x, cnonce="%s"`, chal.qop, nc, cnonce)
+	}
+	req.Header.Set("Authorization", auth)
+	return nil
+}
+func (obj *digestAuth) Challenge(req *http.Request, resp *http.Response) (bool, error) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false, nil
+	}
+	var params map[string]string
+	for _, val := range resp.Header.Values("Www-Authenticate") {
+		if len(val) > 7 && strings.EqualFold(val[:7], "digest ") {
+			params = parseAuthParams(val[7:])
+			break
+		}
+	}
+	if params == nil || params["nonce"] == "" {
+		return false, nil
+	}
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	//已经使用这个nonce 认证过,并且nonce 没有过期,说明用户名密码错误
+	if old, ok := obj.challenges[req.URL.Host]; ok && old.nonce == params["nonce"] && req.Header.Get("Authorization") != "" && !strings.EqualFold(params["stale"], "true") {
+		return false, nil
+	}
+	challenge := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+	}
+	for _, qop := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			challenge.qop = "auth"
+		}
+	}
+	if params["qop"] != "" && challenge.qop == "" {
+		return false, errors.New("digest 不支持的qop: " + params["qop"])
+	}
+	obj.challenges[req.URL.Host] = challenge
+	return true, nil
+}
+
+type OAuth2Option struct {
+	TokenUrl     string            //获取token 的地址
+	ClientId     string            //client_id
+	ClientSecret string            //client_secret
+	Scopes       []string          //scope
+	RefreshToken string            //设置后使用refresh_token 获取token,否则使用client_credentials
+	Params       map[string]string //获取token 时额外的参数
+	BasicAuth    bool              //使用http basic 认证发送client_id 和client_secret,默认放在body 中
+	ExpiryDelta  time.Duration     //token 提前刷新的时间,default:10s
+	Timeout      time.Duration     //获取token 的超时时间,default:30s
+	Client       *Client           //获取token 的客户端,不能设置Auth
+}
+type oauth2Auth struct {
+	option OAuth2Option
+	token  string
+	expire time.Time
+	lock   sync.Mutex
+}
+
+// oauth2 认证,支持client_credentials 和refresh_token,token 过期或者收到401 时自动刷新
+func NewOAuth2Auth(option OAuth2Option) (Auth, error) {
+	if option.TokenUrl == "" {
+		return nil, errors.New("oauth2 TokenUrl 不能为空")
+	}
+	if option.ExpiryDelta == 0 {
+		option.ExpiryDelta = time.Second * 10
+	}
+	if option.Timeout == 0 {
+		option.Timeout = time.Second * 30
+	}
+	if option.Client == nil {
+		client, err := NewClient(nil, ClientOption{DisCookie: true})
+		if err != nil {
+			return nil, err
+		}
+		option.Client = client
+	}
+	return &oauth2Auth{option: option}, nil
+}
+
+// 返回缓存的token,过期时刷新
+func (obj *oauth2Auth) getToken(req *http.Request) (string, error) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if obj.token != "" && (obj.expire.IsZero() || time.Now().Add(obj.option.ExpiryDelta).Before(obj.expire)) {
+		return obj.token, nil
+	}
+	data := url.Values{}
+	if obj.option.RefreshToken != "" {
+		data.Set("grant_type", "refresh_token")
+		data.Set("refresh_token", obj.option.RefreshToken)
+	} else {
+		data.Set("grant_type", "client_credentials")
+	}
+	if len(obj.option.Scopes) > 0 {
+		data.Set("scope", strings.Join(obj.option.Scopes, " "))
+	}
+	for key, val := range obj.option.Params {
+		data.Set(key, val)
+	}
+	headers := http.Header{
+		"Accept":     []string{"application/json"},
+		"User-Agent": []string{UserAgent},
+	}
+	if obj.option.BasicAuth {
+		headers.Set("Authorization", "Basic "+tools.Base64Encode(url.QueryEscape(obj.option.ClientId)+":"+url.QueryEscape(obj.option.ClientSecret)))
+	} else {
+		data.Set("client_id", obj.option.ClientId)
+		if obj.option.ClientSecret != "" {
+			data.Set("client_secret", obj.option.ClientSecret)
+		}
+	}
+	//不使用请求的ctx,避免继承请求的trace,ip 和重试次数,请求取消时同时取消
+	ctx, cnl := context.WithTimeout(context.Background(), obj.option.Timeout)
+	defer cnl()
+	defer context.AfterFunc(req.Context(), cnl)()
+	resp, err := obj.option.Client.Request(ctx, http.MethodPost, obj.option.TokenUrl, RequestOption{
+		Data:    data.Encode(),
+		Headers: headers,
+	})
+	if err != nil {
+		return "", err
+	}
+	var jsonData gjson.Result
+	if resp.StatusCode() == http.StatusOK {
+		jsonData, err = resp.Json()
+	}
+	if err != nil || jsonData.Get("access_token").String() == "" {
+		return "", tools.WrapError(ErrFatal, fmt.Sprintf("oauth2 获取token 失败,状态码:%d,%s", resp.StatusCode(), resp.Text()))
+	}
+	obj.token = jsonData.Get("access_token").String()
+	if expiresIn := jsonData.Get("expires_in").Int(); expiresIn > 0 {
+		obj.expire = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	} else {
+		obj.expire = time.Time{}
+	}
+	if refreshToken := jsonData.Get("refresh_token").String(); refreshToken != "" {
+		obj.option.RefreshToken = refreshToken
+	}
+	return obj.token, nil
+}
+func (obj *oauth2Auth) Sign(req *http.Request) error {
+	token, err := obj.getToken(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+func (obj *oauth2Auth) Challenge(req *http.Request, resp *http.Response) (bool, error) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false, nil
+	}
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if obj.token == "" || req.Header.Get("Authorization") != "Bearer "+obj.token {
+		return false, nil
+	}
+	obj.token = "" //token 失效,下次签名时刷新
+	return true, nil
+}
+
+type AwsOption struct {
+	AccessKey       string
+	SecretKey       string
+	SessionToken    string           //临时凭证的token
+	Region          string           //default:us-east-1
+	Service         string           //default:s3
+	UnsignedPayload bool             //不计算body 的hash,body 无法重复读取时自动使用
+	Now             func() time.Time //签名使用的时间,可以修正本地时间的偏差,default:time.Now
+}
+type awsAuth struct {
+	option AwsOption
+}
+
+// aws signature v4 签名,适用于s3,minio 等
+func NewAwsAuth(option AwsOption) Auth {
+	if option.Region == "" {
+		option.Region = "us-east-1"
+	}
+	if option.Service == "" {
+		option.Service = "s3"
+	}
+	return &awsAuth{option: option}
+}
+
+// aws 的uri 编码,rfc3986 的非保留字符不编码
+func awsEscape(val string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
+func hmacSha256(key []byte, val string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(tools.StringToBytes(val))
+	return mac.Sum(nil)
+}
+
+// body 的sha256
+func (obj *awsAuth) payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return tools.Hex(sha256.Sum256(nil)), nil
+	}
+	if obj.option.UnsignedPayload || req.GetBody == nil {
+		return "UNSIGNED-PAYLOAD", nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, body); err != nil {
+		return "", err
+	}
+	return tools.Hex(hasher.Sum(nil)), nil
+}
+func (obj *awsAuth) canonicalUri(req *http.Request) string {
+	path := req.URL.Path
+	if path == "" {
+		return "/"
+	}
+	if obj.option.Service == "s3" {
+		return awsEscape(path, false)
+	}
+	return awsEscape(awsEscape(path, false), false) //s3 以外的服务需要编码两次
+}
+func (obj *awsAuth) canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		vals := tools.CopySlices(query[key])
+		sort.Strings(vals)
+		for _, val := range vals {
+			params = append(params, awsEscape(key, true)+"="+awsEscape(val, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+func (obj *awsAuth) Sign(req *http.Request) error {
+	if obj.option.Now != nil {
+		return obj.sign(req, obj.option.Now().UTC())
+	}
+	return obj.sign(req, time.Now().UTC())
+}
+func (obj *awsAuth) sign(req *http.Request, now time.Time) error {
+	payloadHash, err := obj.payloadHash(req)
+	if err != nil {
+		return err
+	}
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if obj.option.Service == "s3" { //只有s3 需要这个header
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if obj.option.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", obj.option.SessionToken)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	signHeaders := map[string]string{"host": host}
+	for key, vals := range req.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-amz-") || key == "content-type" || key == "content-md5" || key == "range" || key == "date" {
+			trimVals := make([]string, len(vals))
+			for i, val := range vals {
+				trimVals[i] = strings.Join(strings.Fields(val), " ")
+			}
+			signHeaders[key] = strings.Join(trimVals, ",")
+		}
+	}
+	keys := make([]string, 0, len(signHeaders))
+	for key := range signHeaders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var canonicalHeaders strings.Builder
+	for _, key := range keys {
+		canonicalHeaders.WriteString(key + ":" + signHeaders[key] + "\n")
+	}
+	signedHeaders := strings.Join(keys, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		obj.canonicalUri(req),
+		obj.canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, obj.option.Region, obj.option.Service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		tools.Hex(sha256.Sum256(tools.StringToBytes(canonicalRequest))),
+	}, "\n")
+	signKey := hmacSha256([]byte("AWS4"+obj.option.SecretKey), date)
+	signKey = hmacSha256(signKey, obj.option.Region)
+	signKey = hmacSha256(signKey, obj.option.Service)
+	signKey = hmacSha256(signKey, "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		obj.option.AccessKey, scope, signedHeaders, tools.Hex(hmacSha256(signKey, stringToSign))))
+	return nil
+}
+func (obj *awsAuth) Challenge(req *http.Request, resp *http.Response) (bool, error) {
+	return false, nil
+}
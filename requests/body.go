@@ -4,18 +4,29 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/justseemore/gospider/bar"
 	"github.com/justseemore/gospider/tools"
 	"github.com/tidwall/gjson"
 )
 
 // 构造一个文件
 type File struct {
-	Key     string //字段的key
-	Name    string //文件名
-	Content []byte //文件的内容
-	Type    string //文件类型
+	Key     string    //字段的key
+	Name    string    //文件名
+	Content []byte    //文件的内容
+	Type    string    //文件类型
+	Path    string    //文件路径,上传时从磁盘流式读取,Name 为空时使用文件名
+	Reader  io.Reader //文件内容,上传时流式读取,只能读取一次,不会重试
+	Size    int64     //Reader 的大小,用于计算Content-Length,小于等于0为未知
 }
 type bodyType = int
 
@@ -87,3 +98,203 @@ func newBody(val any, valType bodyType, dataMap map[string][]string) (*bytes.Rea
 		return newBody(result, valType, dataMap)
 	}
 }
+
+// 读取body 的同时保存一份内容,读取结束或关闭时回调
+type teeBody struct {
+	body io.ReadCloser
+	buf  *bytes.Buffer
+	done func(content []byte, complete bool)
+	once sync.Once
+}
+
+func newTeeBody(body io.ReadCloser, done func(content []byte, complete bool)) *teeBody {
+	return &teeBody{
+		body: body,
+		buf:  bytes.NewBuffer(nil),
+		done: done,
+	}
+}
+func (obj *teeBody) finish(complete bool) {
+	obj.once.Do(func() {
+		obj.done(obj.buf.Bytes(), complete)
+	})
+}
+func (obj *teeBody) Read(b []byte) (n int, err error) {
+	n, err = obj.body.Read(b)
+	obj.buf.Write(b[:n])
+	if err == io.EOF {
+		obj.finish(true)
+	} else if err != nil {
+		obj.finish(false)
+	}
+	return
+}
+func (obj *teeBody) Close() error {
+	err := obj.body.Close()
+	obj.finish(false)
+	return err
+}
+
+var escapeQuotes = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func (obj File) stream() bool {
+	return obj.Reader != nil || obj.Path != ""
+}
+func (obj File) mimeHeader() textproto.MIMEHeader {
+	name := obj.Name
+	if name == "" && obj.Path != "" {
+		name = filepath.Base(obj.Path)
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes.Replace(obj.Key), escapeQuotes.Replace(name)))
+	if obj.Type == "" {
+		h.Set("Content-Type", "application/octet-stream")
+	} else {
+		h.Set("Content-Type", obj.Type)
+	}
+	return h
+}
+
+// 文件的大小,-1 为未知
+func (obj File) size() (int64, error) {
+	switch {
+	case obj.Reader != nil:
+		if obj.Size > 0 {
+			return obj.Size, nil
+		}
+		return -1, nil
+	case obj.Path != "":
+		info, err := os.Stat(obj.Path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	default:
+		return int64(len(obj.Content)), nil
+	}
+}
+func (obj File) write(writer io.Writer) error {
+	switch {
+	case obj.Reader != nil:
+		_, err := io.Copy(writer, obj.Reader)
+		return err
+	case obj.Path != "":
+		file, err := os.Open(obj.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(writer, file)
+		return err
+	default:
+		_, err := writer.Write(obj.Content)
+		return err
+	}
+}
+func writeMultipart(writer *multipart.Writer, dataMap map[string][]string, files []File) error {
+	for key, vals := range dataMap {
+		for _, val := range vals {
+			if err := writer.WriteField(key, val); err != nil {
+				return err
+			}
+		}
+	}
+	for _, file := range files {
+		wp, err := writer.CreatePart(file.mimeHeader())
+		if err != nil {
+			return err
+		}
+		if err = file.write(wp); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (obj *countWriter) Write(con []byte) (int, error) {
+	obj.n += int64(len(con))
+	return len(con), nil
+}
+
+// 计算multipart 的大小,有未知大小的文件时返回-1
+func multipartSize(boundary string, dataMap map[string][]string, files []File) (int64, error) {
+	counter := new(countWriter)
+	writer := multipart.NewWriter(counter)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return 0, err
+	}
+	for key, vals := range dataMap {
+		for _, val := range vals {
+			if err := writer.WriteField(key, val); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for _, file := range files {
+		size, err := file.size()
+		if err != nil {
+			return 0, err
+		}
+		if size < 0 {
+			return -1, nil
+		}
+		if _, err = writer.CreatePart(file.mimeHeader()); err != nil {
+			return 0, err
+		}
+		counter.n += size
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// 流式的multipart body,第一次读取时才开始写入,不会在内存中保存文件
+type multipartBody struct {
+	reader *io.PipeReader
+	once   sync.Once
+	start  func()
+}
+
+func newMultipartBody(boundary string, dataMap map[string][]string, files []File, size int64, showBar bool) (*multipartBody, error) {
+	reader, pipeWriter := io.Pipe()
+	var writer io.Writer = pipeWriter
+	if showBar && size > 0 {
+		writer = &barWriter{writer: pipeWriter, bar: bar.NewClient(size)}
+	}
+	mwriter := multipart.NewWriter(writer)
+	if err := mwriter.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	return &multipartBody{
+		reader: reader,
+		start: func() {
+			go func() {
+				pipeWriter.CloseWithError(writeMultipart(mwriter, dataMap, files))
+			}()
+		},
+	}, nil
+}
+func (obj *multipartBody) Read(con []byte) (int, error) {
+	obj.once.Do(obj.start)
+	return obj.reader.Read(con)
+}
+func (obj *multipartBody) Close() error {
+	return obj.reader.Close()
+}
+
+// 上传进度
+type barWriter struct {
+	writer io.Writer
+	bar    *bar.Client
+}
+
+func (obj *barWriter) Write(con []byte) (int, error) {
+	n, err := obj.writer.Write(con)
+	obj.bar.Print(int64(n))
+	return n, err
+}
@@ -0,0 +1,492 @@
+package requests
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justseemore/gospider/redis"
+	"github.com/justseemore/gospider/tools"
+)
+
+// http 缓存的存储,实现这个接口可以自定义存储
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, val []byte, ttl time.Duration) error //ttl 为保存的时间,0:不过期
+	Del(key string) error
+}
+
+// 过期时间,0:不过期
+func cacheExpire(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+type memoryCacheItem struct {
+	key    string
+	val    []byte
+	expire time.Time
+}
+type memoryCacheStore struct {
+	maxEntries int
+	datas      map[string]*list.Element
+	order      *list.List //最近使用的在前面
+	lock       sync.Mutex
+}
+
+// 内存缓存,按最近使用的顺序最多保留maxEntries 个,小于等于0时default:1000
+func NewMemoryCacheStore(maxEntries int) CacheStore {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	return &memoryCacheStore{
+		maxEntries: maxEntries,
+		datas:      make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+func (obj *memoryCacheStore) Get(key string) ([]byte, bool) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	element, ok := obj.datas[key]
+	if !ok {
+		return nil, false
+	}
+	item := element.Value.(*memoryCacheItem)
+	if !item.expire.IsZero() && !item.expire.After(time.Now()) {
+		obj.order.Remove(element)
+		delete(obj.datas, key)
+		return nil, false
+	}
+	obj.order.MoveToFront(element)
+	return item.val, true
+}
+func (obj *memoryCacheStore) Set(key string, val []byte, ttl time.Duration) error {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	item := &memoryCacheItem{key: key, val: val, expire: cacheExpire(ttl)}
+	if element, ok := obj.datas[key]; ok {
+		element.Value = item
+		obj.order.MoveToFront(element)
+		return nil
+	}
+	obj.datas[key] = obj.order.PushFront(item)
+	for obj.order.Len() > obj.maxEntries {
+		evicted := obj.order.Remove(obj.order.Back()).(*memoryCacheItem)
+		delete(obj.datas, evicted.key)
+	}
+	return nil
+}
+func (obj *memoryCacheStore) Del(key string) error {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if element, ok := obj.datas[key]; ok {
+		obj.order.Remove(element)
+		delete(obj.datas, key)
+	}
+	return nil
+}
+
+type dirCacheStore struct {
+	dir string
+}
+
+// 磁盘缓存,每个缓存存储为目录中的一个文件,文件的前8个字节为过期时间
+func NewDirCacheStore(dir string) (CacheStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirCacheStore{dir: dir}, nil
+}
+func (obj *dirCacheStore) path(key string) string {
+	return tools.PathJoin(obj.dir, tools.Hex(tools.Md5(key)))
+}
+func (obj *dirCacheStore) Get(key string) ([]byte, bool) {
+	con, err := os.ReadFile(obj.path(key))
+	if err != nil || len(con) < 8 {
+		return nil, false
+	}
+	if expire := int64(binary.BigEndian.Uint64(con)); expire != 0 && time.Now().UnixNano() >= expire {
+		os.Remove(obj.path(key))
+		return nil, false
+	}
+	return con[8:], true
+}
+func (obj *dirCacheStore) Set(key string, val []byte, ttl time.Duration) error {
+	var expire int64
+	if expireTime := cacheExpire(ttl); !expireTime.IsZero() {
+		expire = expireTime.UnixNano()
+	}
+	con := binary.BigEndian.AppendUint64(make([]byte, 0, len(val)+8), uint64(expire))
+	tempFile, err := os.CreateTemp(obj.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write(append(con, val...))
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tempFile.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), obj.path(key))
+}
+func (obj *dirCacheStore) Del(key string) error {
+	if err := os.Remove(obj.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type redisCacheStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// redis 缓存,prefix 为key 的前缀
+func NewRedisCacheStore(client *redis.Client, prefix string) CacheStore {
+	return &redisCacheStore{client: client, prefix: prefix}
+}
+func (obj *redisCacheStore) Get(key string) ([]byte, bool) {
+	val, err := obj.client.Get(obj.prefix + key)
+	if err != nil {
+		return nil, false
+	}
+	return tools.StringToBytes(val), true
+}
+func (obj *redisCacheStore) Set(key string, val []byte, ttl time.Duration) error {
+	return obj.client.Set(obj.prefix+key, val, ttl)
+}
+func (obj *redisCacheStore) Del(key string) error {
+	_, err := obj.client.Del(obj.prefix + key)
+	return err
+}
+
+type CacheStatus int
+
+const (
+	CacheMiss        CacheStatus = iota //没有使用缓存
+	CacheHit                            //直接使用缓存
+	CacheRevalidated                    //服务器验证后使用缓存
+)
+
+type cacheEntry struct {
+	VaryKeys     []string `json:",omitempty"` //响应有Vary 时,url 的key 只保存Vary 的请求头,每个变体保存在单独的key
+	StatusCode   int
+	Status       string
+	Proto        string
+	Header       http.Header
+	Content      []byte
+	Vary         map[string]string
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+func (obj *cacheEntry) response(req *http.Request) *http.Response {
+	resp := &http.Response{
+		Status:        obj.Status,
+		StatusCode:    obj.StatusCode,
+		Proto:         obj.Proto,
+		Header:        obj.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(obj.Content)),
+		ContentLength: int64(len(obj.Content)),
+		Request:       req,
+	}
+	var protoOk bool
+	if resp.ProtoMajor, resp.ProtoMinor, protoOk = http.ParseHTTPVersion(resp.Proto); !protoOk {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	resp.Header.Set("Age", strconv.FormatInt(int64(obj.age()/time.Second), 10))
+	return resp
+}
+func (obj *cacheEntry) varyMatch(req *http.Request) bool {
+	for key, val := range obj.Vary {
+		if req.Header.Get(key) != val {
+			return false
+		}
+	}
+	return true
+}
+
+// rfc9111 4.2.3
+func (obj *cacheEntry) age() time.Duration {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(obj.Header.Get("Date")); err == nil {
+		if apparentAge = obj.ResponseTime.Sub(date); apparentAge < 0 {
+			apparentAge = 0
+		}
+	}
+	var ageValue time.Duration
+	if age, err := strconv.ParseInt(obj.Header.Get("Age"), 10, 64); err == nil {
+		ageValue = time.Duration(age) * time.Second
+	}
+	correctedAge := ageValue + obj.ResponseTime.Sub(obj.RequestTime)
+	if apparentAge > correctedAge {
+		correctedAge = apparentAge
+	}
+	return correctedAge + time.Since(obj.ResponseTime)
+}
+
+// rfc9111 4.2.1
+func (obj *cacheEntry) lifetime() time.Duration {
+	cc := parseCacheControl(obj.Header)
+	if maxAge, ok := cc["max-age"]; ok {
+		if seconds, err := strconv.ParseInt(maxAge, 10, 64); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+	date, dateErr := http.ParseTime(obj.Header.Get("Date"))
+	if dateErr != nil {
+		date = obj.ResponseTime
+	}
+	if expiresStr := obj.Header.Get("Expires"); expiresStr != "" {
+		expires, err := http.ParseTime(expiresStr)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	//启发式过期时间,rfc9111 4.2.2
+	if lastModified, err := http.ParseTime(obj.Header.Get("Last-Modified")); err == nil && heuristicStatus(obj.StatusCode) {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+func (obj *cacheEntry) fresh() bool {
+	cc := parseCacheControl(obj.Header)
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+	return obj.lifetime() > obj.age()
+}
+
+// 更新304 返回的headers,rfc9111 3.2
+func (obj *cacheEntry) update(header http.Header) {
+	for key, vals := range header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", "Content-Range":
+		default:
+			obj.Header[key] = vals
+		}
+	}
+}
+func heuristicStatus(statusCode int) bool {
+	switch statusCode {
+	case 200, 203, 204, 206, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	default:
+		return false
+	}
+}
+func parseCacheControl(header http.Header) map[string]string {
+	cc := map[string]string{}
+	for _, val := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(val, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			key, value, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return cc
+}
+
+type cacheRoundTripper struct {
+	store CacheStore
+	next  http.RoundTripper
+}
+
+func (obj *cacheRoundTripper) CloseIdleConnections() {
+	if closeIdler, ok := obj.next.(interface{ CloseIdleConnections() }); ok {
+		closeIdler.CloseIdleConnections()
+	}
+}
+
+// 过期后继续保留用于验证的时间
+const cacheStaleTime = time.Hour * 24
+
+func cacheKey(req *http.Request) string {
+	return fmt.Sprintf("%s %s", http.MethodGet, req.URL.String())
+}
+
+// 变体的key,由url 和Vary 中请求头的值组成
+func cacheVaryKey(key string, varyKeys []string, req *http.Request) string {
+	for _, varyKey := range varyKeys {
+		key += "\n" + varyKey + ": " + req.Header.Get(varyKey)
+	}
+	return key
+}
+func cacheVaryKeys(header http.Header) []string {
+	var varyKeys []string
+	for _, vary := range header.Values("Vary") {
+		for _, key := range strings.Split(vary, ",") {
+			if key = http.CanonicalHeaderKey(strings.TrimSpace(key)); key != "" {
+				varyKeys = append(varyKeys, key)
+			}
+		}
+	}
+	sort.Strings(varyKeys)
+	return varyKeys
+}
+
+// 存储的时间为剩余的新鲜时间加上cacheStaleTime
+func (obj *cacheEntry) ttl() time.Duration {
+	return max(obj.lifetime()-obj.age(), 0) + cacheStaleTime
+}
+func (obj *cacheRoundTripper) load(key string) *cacheEntry {
+	con, ok := obj.store.Get(key)
+	if !ok {
+		return nil
+	}
+	var entry cacheEntry
+	if err := tools.JsonUnMarshal(con, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+func (obj *cacheRoundTripper) save(key string, entry *cacheEntry, ttl time.Duration) {
+	if con, err := tools.JsonMarshal(entry); err == nil {
+		obj.store.Set(key, con, ttl)
+	}
+}
+
+// 加载请求对应的缓存,返回缓存和保存的key
+func (obj *cacheRoundTripper) loadVary(req *http.Request) (*cacheEntry, string) {
+	key := cacheKey(req)
+	entry := obj.load(key)
+	if entry != nil && len(entry.VaryKeys) > 0 {
+		key = cacheVaryKey(key, entry.VaryKeys, req)
+		entry = obj.load(key)
+	}
+	if entry != nil && (entry.StatusCode == 0 || !entry.varyMatch(req)) {
+		entry = nil
+	}
+	return entry, key
+}
+
+// 是否可以存储,rfc9111 3
+func (obj *cacheRoundTripper) storable(req *http.Request, resp *http.Response) bool {
+	if _, ok := parseCacheControl(req.Header)["no-store"]; ok {
+		return false
+	}
+	respCc := parseCacheControl(resp.Header)
+	if _, ok := respCc["no-store"]; ok {
+		return false
+	}
+	if resp.Header.Get("Vary") == "*" || resp.StatusCode == http.StatusPartialContent {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" {
+		_, public := respCc["public"]
+		_, mustRevalidate := respCc["must-revalidate"]
+		_, sMaxAge := respCc["s-maxage"]
+		if !public && !mustRevalidate && !sMaxAge {
+			return false
+		}
+	}
+	if _, ok := respCc["max-age"]; ok {
+		return true
+	}
+	if resp.Header.Get("Expires") != "" || resp.Header.Get("ETag") != "" {
+		return true
+	}
+	return heuristicStatus(resp.StatusCode) && resp.Header.Get("Last-Modified") != ""
+}
+func (obj *cacheRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctxData := req.Context().Value(keyPrincipalID).(*reqCtxData)
+	ctxData.cacheStatus = CacheMiss
+	reqCc := parseCacheControl(req.Header)
+	_, reqNoStore := reqCc["no-store"]
+	if ctxData.disCache || ctxData.ws || reqNoStore {
+		return obj.next.RoundTrip(req)
+	}
+	if req.Method != http.MethodGet {
+		resp, err := obj.next.RoundTrip(req)
+		if err == nil && req.Method != http.MethodHead && resp.StatusCode < 400 { //不安全的方法使缓存失效,rfc9111 4.4
+			obj.store.Del(cacheKey(req))
+		}
+		return resp, err
+	}
+	entry, key := obj.loadVary(req)
+	_, reqNoCache := reqCc["no-cache"]
+	if entry != nil && !reqNoCache && reqCc["max-age"] != "0" && entry.fresh() {
+		ctxData.cacheStatus = CacheHit
+		return entry.response(req), nil
+	}
+	sendReq := req
+	if entry != nil {
+		etag := entry.Header.Get("ETag")
+		lastModified := entry.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			sendReq = req.Clone(req.Context())
+			if etag != "" && sendReq.Header.Get("If-None-Match") == "" {
+				sendReq.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" && sendReq.Header.Get("If-Modified-Since") == "" {
+				sendReq.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	requestTime := time.Now()
+	resp, err := obj.next.RoundTrip(sendReq)
+	if err != nil {
+		return resp, err
+	}
+	if entry != nil && resp.StatusCode == http.StatusNotModified && sendReq != req {
+		tools.CopyWitchContext(req.Context(), io.Discard, resp.Body)
+		resp.Body.Close()
+		entry.update(resp.Header)
+		entry.RequestTime, entry.ResponseTime = requestTime, time.Now()
+		obj.save(key, entry, entry.ttl())
+		ctxData.cacheStatus = CacheRevalidated
+		return entry.response(req), nil
+	}
+	if !obj.storable(req, resp) {
+		return resp, nil
+	}
+	responseTime := time.Now()
+	resp.Body = newTeeBody(resp.Body, func(content []byte, complete bool) {
+		if !complete {
+			return
+		}
+		newEntry := &cacheEntry{
+			StatusCode:   resp.StatusCode,
+			Status:       resp.Status,
+			Proto:        resp.Proto,
+			Header:       resp.Header.Clone(),
+			Content:      tools.CopySlices(content),
+			Vary:         map[string]string{},
+			RequestTime:  requestTime,
+			ResponseTime: responseTime,
+		}
+		key := cacheKey(req)
+		ttl := newEntry.ttl()
+		if varyKeys := cacheVaryKeys(resp.Header); len(varyKeys) > 0 { //不同的变体保存在不同的key,可以同时存在
+			for _, varyKey := range varyKeys {
+				newEntry.Vary[varyKey] = req.Header.Get(varyKey)
+			}
+			obj.save(key, &cacheEntry{VaryKeys: varyKeys}, ttl)
+			key = cacheVaryKey(key, varyKeys, req)
+		}
+		obj.save(key, newEntry, ttl)
+	})
+	return resp, nil
+}
@@ -2,8 +2,12 @@ package requests
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/justseemore/gospider/tools"
@@ -46,3 +50,97 @@ func (obj *pwdConn) SetReadDeadline(t time.Time) error {
 func (obj *pwdConn) SetWriteDeadline(t time.Time) error {
 	return obj.rawConn.SetWriteDeadline(t)
 }
+
+// http1.1 的连接,按照请求头的顺序和大小写重写请求头,每次请求前通过setOrder 设置
+type orderConn struct {
+	net.Conn
+	lock   sync.Mutex
+	orders []string
+	buf    bytes.Buffer
+}
+
+// tls 连接需要实现ConnectionState,http.Transport 才能获取tls 信息
+type orderTlsConn struct {
+	*orderConn
+	tlsConn *tls.Conn
+}
+
+func (obj *orderTlsConn) ConnectionState() tls.ConnectionState {
+	return obj.tlsConn.ConnectionState()
+}
+func (obj *orderConn) setOrder(orders []string) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	obj.orders = orders
+	obj.buf.Reset()
+}
+func (obj *orderConn) Write(b []byte) (n int, err error) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if obj.orders == nil {
+		return obj.Conn.Write(b)
+	}
+	obj.buf.Write(b)
+	index := bytes.Index(obj.buf.Bytes(), []byte("\r\n\r\n"))
+	if index == -1 { //请求头还没有写完
+		return len(b), nil
+	}
+	con := orderHeaderBlock(obj.buf.Bytes()[:index], obj.orders)
+	con = append(con, obj.buf.Bytes()[index:]...)
+	obj.orders = nil
+	obj.buf.Reset()
+	if _, err = obj.Conn.Write(con); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// 按照顺序重新排列请求头,不在顺序中的请求头保持原来的顺序放在后面,没有指定Host 的位置时Host 在最前面
+func orderHeaderBlock(block []byte, orders []string) []byte {
+	lines := strings.Split(string(block), "\r\n")
+	names := make([]string, len(lines))
+	for i, line := range lines[1:] {
+		name, _, _ := strings.Cut(line, ":")
+		names[i+1] = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	}
+	used := make([]bool, len(lines))
+	result := bytes.NewBufferString(lines[0])
+	write := func(i int, name string) {
+		used[i] = true
+		result.WriteString("\r\n")
+		if name != "" {
+			_, val, _ := strings.Cut(lines[i], ":")
+			result.WriteString(name + ":" + val)
+		} else {
+			result.WriteString(lines[i])
+		}
+	}
+	var hasHost bool
+	for _, order := range orders {
+		if http.CanonicalHeaderKey(order) == "Host" {
+			hasHost = true
+			break
+		}
+	}
+	if !hasHost {
+		for i := 1; i < len(lines); i++ {
+			if names[i] == "Host" {
+				write(i, "")
+			}
+		}
+	}
+	for _, order := range orders {
+		key := http.CanonicalHeaderKey(order)
+		for i := 1; i < len(lines); i++ {
+			if !used[i] && names[i] == key {
+				write(i, order)
+			}
+		}
+	}
+	for i := 1; i < len(lines); i++ {
+		if !used[i] {
+			write(i, "")
+		}
+	}
+	return result.Bytes()
+}
@@ -0,0 +1,810 @@
+package requests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/justseemore/gospider/tools"
+)
+
+// 把bash 格式的命令拆分成参数,支持单引号,双引号,$'...' 和反斜杠换行
+func splitCurl(cmd string) ([]string, error) {
+	args := []string{}
+	var arg bytes.Buffer
+	var inArg bool
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '\\':
+			if i+1 < len(cmd) {
+				i++
+				if cmd[i] == '\n' { //续行
+					continue
+				} else if cmd[i] == '\r' && i+1 < len(cmd) && cmd[i+1] == '\n' {
+					i++
+					continue
+				}
+				arg.WriteByte(cmd[i])
+				inArg = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(cmd[i+1:], '\'')
+			if end == -1 {
+				return nil, errors.New("单引号没有闭合")
+			}
+			arg.WriteString(cmd[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '$' && i+1 < len(cmd) && cmd[i+1] == '\'':
+			n, err := unquoteAnsi(cmd[i+2:], &arg)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(cmd) && cmd[i] != '"'; i++ {
+				if cmd[i] == '\\' && i+1 < len(cmd) && strings.IndexByte("$`\"\\\n", cmd[i+1]) != -1 {
+					i++
+					if cmd[i] == '\n' {
+						continue
+					}
+				}
+				arg.WriteByte(cmd[i])
+			}
+			if i >= len(cmd) {
+				return nil, errors.New("双引号没有闭合")
+			}
+			inArg = true
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// 解析$'...' 中的内容,返回消耗的长度,包括结尾的引号
+func unquoteAnsi(val string, arg *bytes.Buffer) (int, error) {
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		if c == '\'' {
+			return i + 1, nil
+		}
+		if c != '\\' || i+1 >= len(val) {
+			arg.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = val[i]; c {
+		case 'n':
+			arg.WriteByte('\n')
+		case 'r':
+			arg.WriteByte('\r')
+		case 't':
+			arg.WriteByte('\t')
+		case 'a':
+			arg.WriteByte('\a')
+		case 'b':
+			arg.WriteByte('\b')
+		case 'f':
+			arg.WriteByte('\f')
+		case 'v':
+			arg.WriteByte('\v')
+		case 'e', 'E':
+			arg.WriteByte(0x1b)
+		case 'x', 'u', 'U', '0', '1', '2', '3', '4', '5', '6', '7':
+			base, size := 16, 2
+			switch c {
+			case 'u':
+				size = 4
+			case 'U':
+				size = 8
+			case 'x':
+			default:
+				base, size = 8, 3
+				i--
+			}
+			j := i + 1
+			for ; j < len(val) && j-i-1 < size; j++ {
+				if _, err := strconv.ParseUint(val[j:j+1], base, 8); err != nil {
+					break
+				}
+			}
+			num, err := strconv.ParseUint(val[i+1:j], base, 32)
+			if err != nil {
+				return 0, tools.WrapError(err, "$'' 转义错误")
+			}
+			if c == 'u' || c == 'U' {
+				arg.WriteRune(rune(num))
+			} else {
+				arg.WriteByte(byte(num))
+			}
+			i = j - 1
+		default:
+			arg.WriteByte(c)
+		}
+	}
+	return 0, errors.New("$'' 没有闭合")
+}
+
+// curl 中需要参数的短选项
+var curlShortArgs = map[byte]string{
+	'X': "--request",
+	'H': "--header",
+	'b': "--cookie",
+	'd': "--data",
+	'F': "--form",
+	'x': "--proxy",
+	'A': "--user-agent",
+	'e': "--referer",
+	'u': "--user",
+	'm': "--max-time",
+	'o': "--output",
+	'w': "--write-out",
+	'c': "--cookie-jar",
+	'D': "--dump-header",
+	'U': "--proxy-user",
+	'T': "--upload-file",
+	'r': "--range",
+	'E': "--cert",
+}
+
+// curl 中不需要参数的短选项
+var curlShortFlags = map[byte]string{
+	'k': "--insecure",
+	's': "--silent",
+	'S': "--show-error",
+	'v': "--verbose",
+	'i': "--include",
+	'L': "--location",
+	'G': "--get",
+	'I': "--head",
+	'f': "--fail",
+	'N': "--no-buffer",
+	'g': "--globoff",
+	'O': "--remote-name",
+	'#': "--progress-bar",
+}
+
+// 忽略的长选项,值为是否需要参数
+var curlIgnores = map[string]bool{
+	"--insecure":                  false,
+	"--silent":                    false,
+	"--show-error":                false,
+	"--verbose":                   false,
+	"--include":                   false,
+	"--location":                  false,
+	"--location-trusted":          false,
+	"--fail":                      false,
+	"--no-buffer":                 false,
+	"--globoff":                   false,
+	"--remote-name":               false,
+	"--progress-bar":              false,
+	"--basic":                     false,
+	"--http1.0":                   false,
+	"--http1.1":                   false,
+	"--http2":                     false,
+	"--http2-prior-knowledge":     false,
+	"--http3":                     false,
+	"--tlsv1":                     false,
+	"--tlsv1.0":                   false,
+	"--tlsv1.1":                   false,
+	"--tlsv1.2":                   false,
+	"--tlsv1.3":                   false,
+	"--no-keepalive":              false,
+	"--path-as-is":                false,
+	"--output":                    true,
+	"--write-out":                 true,
+	"--cookie-jar":                true,
+	"--dump-header":               true,
+	"--connect-timeout":           true,
+	"--resolve":                   true,
+	"--cert":                      true,
+	"--key":                       true,
+	"--cacert":                    true,
+	"--range":                     true,
+	"--keepalive-time":            true,
+	"--limit-rate":                true,
+	"--ciphers":                   true,
+	"--trace":                     true,
+	"--trace-ascii":               true,
+	"--stderr":                    true,
+	"--interface":                 true,
+	"--retry-delay":               true,
+	"--retry-max-time":            true,
+	"--expect100-timeout":         true,
+	"--happy-eyeballs-timeout-ms": true,
+}
+
+// curl 中的url 编码,空格编码为%20
+func curlEscape(val string) string {
+	return strings.ReplaceAll(url.QueryEscape(val), "+", "%20")
+}
+
+// 读取@ 开头的文件参数
+func curlReadFile(val string) ([]byte, error) {
+	if val == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	con, err := os.ReadFile(val)
+	if err != nil {
+		return nil, tools.WrapError(err, "curl 读取文件错误")
+	}
+	return con, nil
+}
+
+// 解析--data-urlencode 的参数
+func curlUrlencode(val string) (string, error) {
+	index := strings.IndexAny(val, "=@")
+	if index == -1 {
+		return curlEscape(val), nil
+	}
+	name := val[:index]
+	content := val[index+1:]
+	if val[index] == '@' {
+		con, err := curlReadFile(content)
+		if err != nil {
+			return "", err
+		}
+		content = string(con)
+	}
+	if name == "" {
+		return curlEscape(content), nil
+	}
+	return name + "=" + curlEscape(content), nil
+}
+
+// 解析-F 的参数,返回表单的值或者文件
+func curlForm(val string, form map[string][]string) (*File, error) {
+	name, content, ok := strings.Cut(val, "=")
+	if !ok {
+		return nil, errors.New("curl -F 参数错误: " + val)
+	}
+	switch {
+	case strings.HasPrefix(content, "@"):
+		params := strings.Split(content[1:], ";")
+		file := &File{Key: name, Path: strings.Trim(params[0], `"`)}
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			value = strings.Trim(value, `"`)
+			switch key {
+			case "type":
+				file.Type = value
+			case "filename":
+				file.Name = value
+			}
+		}
+		return file, nil
+	case strings.HasPrefix(content, "<"):
+		params := strings.Split(content[1:], ";")
+		con, err := curlReadFile(params[0])
+		if err != nil {
+			return nil, err
+		}
+		form[name] = append(form[name], string(con))
+	default:
+		form[name] = append(form[name], content)
+	}
+	return nil, nil
+}
+
+// 给没有协议的地址加上默认协议
+func curlScheme(href string, scheme string) string {
+	if !strings.Contains(href, "://") {
+		return scheme + "://" + href
+	}
+	return href
+}
+
+// 解析浏览器中"Copy as cURL (bash)" 得到的命令,返回method,url 和请求参数
+//
+// 支持-X,-H,-b,-d,--data-raw,--data-binary,--data-urlencode,-G,-F,-u,--digest,-x,-A,-e,-m,--retry,--compressed,-k 等参数
+//
+// 请求时的tls 证书始终不做校验,所以-k 会被忽略。Headers 只包含命令中的请求头,不会添加默认的请求头
+func ParseCurl(cmd string) (method string, href string, option RequestOption, err error) {
+	args, err := splitCurl(strings.TrimSpace(cmd))
+	if err != nil {
+		return
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl") || strings.HasSuffix(args[0], "curl.exe")) {
+		args = args[1:]
+	}
+	headers := http.Header{}
+	form := map[string][]string{}
+	var datas, cookies []string
+	var get, head, compressed, digest, hasData bool
+	var user, proxyUser string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" || arg[0] != '-' || arg == "-" {
+			if href == "" {
+				href = arg
+			}
+			continue
+		}
+		name := arg
+		var value string
+		var hasValue bool
+		if !strings.HasPrefix(arg, "--") { //短选项,可以合并在一起,例如:-sSL,-XPOST
+			name = ""
+			for j := 1; j < len(arg); j++ {
+				if long, ok := curlShortArgs[arg[j]]; ok {
+					name = long
+					if j+1 < len(arg) {
+						value, hasValue = arg[j+1:], true
+					}
+					break
+				}
+				long, ok := curlShortFlags[arg[j]]
+				if !ok {
+					err = errors.New("不支持的curl 参数: -" + string(arg[j]))
+					return
+				}
+				switch long {
+				case "--get":
+					get = true
+				case "--head":
+					head = true
+				}
+			}
+			if name == "" {
+				continue
+			}
+		}
+		needValue, ignore := curlIgnores[name]
+		switch name {
+		case "--get":
+			get = true
+			continue
+		case "--head":
+			head = true
+			continue
+		case "--compressed":
+			compressed = true
+			continue
+		case "--digest":
+			digest = true
+			continue
+		default:
+			if ignore && !needValue {
+				continue
+			}
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				err = errors.New("curl 参数缺少值: " + arg)
+				return
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "--url":
+			href = value
+		case "--request":
+			method = value
+		case "--header":
+			key, val, ok := strings.Cut(value, ":")
+			key = strings.TrimSpace(key)
+			if !ok {
+				if strings.HasSuffix(key, ";") { //"Name;" 发送空值
+					headers.Add(strings.TrimSuffix(key, ";"), "")
+				}
+				continue
+			}
+			if val = strings.TrimSpace(val); val == "" { //"Name:" 删除请求头
+				headers.Del(key)
+			} else if strings.EqualFold(key, "cookie") {
+				cookies = append(cookies, val)
+			} else {
+				headers.Add(key, val)
+			}
+		case "--cookie":
+			if strings.Contains(value, "=") {
+				cookies = append(cookies, value)
+			} else { //netscape 格式的cookie 文件
+				if option.Jar == nil {
+					option.Jar = NewJar()
+				}
+				if err = option.Jar.Load(value, JarNetscape); err != nil {
+					return
+				}
+			}
+		case "--data", "--data-ascii", "--data-binary", "--data-raw", "--json":
+			hasData = true
+			if strings.HasPrefix(value, "@") && name != "--data-raw" {
+				var con []byte
+				if con, err = curlReadFile(value[1:]); err != nil {
+					return
+				}
+				if value = string(con); name != "--data-binary" && name != "--json" {
+					value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+				}
+			}
+			if name == "--json" {
+				if headers.Get("Content-Type") == "" {
+					headers.Set("Content-Type", "application/json")
+				}
+				if headers.Get("Accept") == "" {
+					headers.Set("Accept", "application/json")
+				}
+			}
+			datas = append(datas, value)
+		case "--data-urlencode":
+			hasData = true
+			if value, err = curlUrlencode(value); err != nil {
+				return
+			}
+			datas = append(datas, value)
+		case "--form", "--form-string":
+			var file *File
+			if name == "--form-string" {
+				key, val, _ := strings.Cut(value, "=")
+				form[key] = append(form[key], val)
+			} else if file, err = curlForm(value, form); err != nil {
+				return
+			} else if file != nil {
+				option.Files = append(option.Files, *file)
+			}
+		case "--user":
+			user = value
+		case "--user-agent":
+			headers.Set("User-Agent", value)
+		case "--referer":
+			headers.Set("Referer", value)
+		case "--proxy":
+			option.Proxy = curlScheme(value, "http")
+		case "--socks5":
+			option.Proxy = curlScheme(value, "socks5")
+		case "--socks5-hostname":
+			option.Proxy = curlScheme(value, "socks5h")
+		case "--socks4":
+			option.Proxy = curlScheme(value, "socks4")
+		case "--socks4a":
+			option.Proxy = curlScheme(value, "socks4a")
+		case "--proxy-user":
+			proxyUser = value
+		case "--noproxy":
+			if value == "*" {
+				option.DisProxy = true
+			}
+		case "--max-time":
+			var seconds float64
+			if seconds, err = strconv.ParseFloat(value, 64); err != nil {
+				err = tools.WrapError(err, "curl --max-time 错误")
+				return
+			}
+			option.Timeout = time.Duration(seconds * float64(time.Second))
+		case "--retry":
+			if option.TryNum, err = strconv.ParseInt(value, 10, 64); err != nil {
+				err = tools.WrapError(err, "curl --retry 错误")
+				return
+			}
+		case "--max-redirs":
+			var num int
+			if num, err = strconv.Atoi(value); err != nil {
+				err = tools.WrapError(err, "curl --max-redirs 错误")
+				return
+			}
+			if num == 0 {
+				num = -1
+			}
+			option.RedirectNum = num
+		default:
+			if !ignore {
+				err = errors.New("不支持的curl 参数: " + name)
+				return
+			}
+		}
+	}
+	if href == "" {
+		err = errors.New("curl 命令中没有url")
+		return
+	}
+	href = curlScheme(href, "http")
+	//处理body
+	if hasData {
+		data := strings.Join(datas, "&")
+		if get {
+			if strings.Contains(href, "?") {
+				href += "&" + data
+			} else {
+				href += "?" + data
+			}
+		} else {
+			option.Data = data
+		}
+	}
+	if len(form) > 0 {
+		option.Form = form
+	}
+	//处理认证
+	if user != "" {
+		usr, pwd, _ := strings.Cut(user, ":")
+		if digest {
+			option.Auth = NewDigestAuth(usr, pwd)
+		} else {
+			headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(usr+":"+pwd)))
+		}
+	}
+	if proxyUser != "" && option.Proxy != "" {
+		var proxy *url.URL
+		if proxy, err = url.Parse(option.Proxy); err != nil {
+			err = tools.WrapError(err, "curl 代理解析错误")
+			return
+		}
+		usr, pwd, _ := strings.Cut(proxyUser, ":")
+		proxy.User = url.UserPassword(usr, pwd)
+		option.Proxy = proxy.String()
+	}
+	if compressed && headers.Get("Accept-Encoding") == "" {
+		headers.Set("Accept-Encoding", "gzip, deflate, br")
+	}
+	if len(cookies) > 0 {
+		option.Cookies = strings.Join(cookies, "; ")
+	}
+	option.Headers = headers
+	//处理method
+	if method == "" {
+		switch {
+		case head:
+			method = http.MethodHead
+		case get:
+			method = http.MethodGet
+		case hasData || len(form) > 0 || len(option.Files) > 0:
+			method = http.MethodPost
+		default:
+			method = http.MethodGet
+		}
+	}
+	method = strings.ToUpper(method)
+	return
+}
+
+// 按照bash 的规则给参数加引号,有控制字符时使用$'...'
+func curlQuote(val string) string {
+	if val == "" {
+		return "''"
+	}
+	ansi := !utf8.ValidString(val)
+	if !ansi {
+		for i := 0; i < len(val); i++ {
+			if val[i] < 0x20 || val[i] == 0x7f {
+				ansi = true
+				break
+			}
+		}
+	}
+	if !ansi {
+		if strings.IndexFunc(val, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+%", r))
+		}) == -1 {
+			return val
+		}
+		return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+	}
+	var builder strings.Builder
+	builder.WriteString("$'")
+	for i := 0; i < len(val); {
+		r, size := utf8.DecodeRuneInString(val[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&builder, `\x%02x`, val[i])
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r == '\t':
+			builder.WriteString(`\t`)
+		case r == '\\' || r == '\'':
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&builder, `\x%02x`, r)
+		default:
+			builder.WriteString(val[i : i+size])
+		}
+		i += size
+	}
+	builder.WriteByte('\'')
+	return builder.String()
+}
+
+// curl 命令构造
+type curlBuilder struct {
+	method []string
+	args   []string
+}
+
+func (obj *curlBuilder) add(flag string, val string) {
+	obj.args = append(obj.args, flag+" "+curlQuote(val))
+}
+
+// 按照orders 的顺序和大小写添加请求头,剩下的请求头排序后添加
+func (obj *curlBuilder) addHeaders(headers http.Header, orders []string) {
+	keys := make([]string, 0, len(headers))
+	names := map[string]string{}
+	for _, order := range orders {
+		key := http.CanonicalHeaderKey(order)
+		if _, ok := names[key]; !ok && headers[key] != nil {
+			names[key] = order
+			keys = append(keys, key)
+		}
+	}
+	others := []string{}
+	for key := range headers {
+		if _, ok := names[key]; !ok {
+			others = append(others, key)
+		}
+	}
+	sort.Strings(others)
+	for _, key := range append(keys, others...) {
+		name := key
+		if order, ok := names[key]; ok {
+			name = order
+		}
+		for _, val := range headers[key] {
+			if strings.EqualFold(key, "cookie") {
+				obj.add("-b", val)
+			} else if val == "" {
+				obj.add("-H", name+";")
+			} else {
+				obj.add("-H", name+": "+val)
+			}
+		}
+	}
+}
+func (obj *curlBuilder) addMethod(method string, hasBody bool) {
+	switch method = strings.ToUpper(method); {
+	case method == "" || method == http.MethodGet && !hasBody:
+	case method == http.MethodPost && hasBody:
+	case method == http.MethodHead && !hasBody:
+		obj.method = []string{"-I"}
+	default:
+		obj.method = []string{"-X " + curlQuote(method)}
+	}
+}
+func (obj *curlBuilder) addBody(body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	if utf8.Valid(body) && !bytes.ContainsAny(body, "\x00") {
+		obj.add("--data-raw", string(body))
+	} else {
+		obj.add("--data-binary", string(body))
+	}
+}
+func (obj *curlBuilder) String(href string) string {
+	args := append([]string{"curl " + curlQuote(href)}, obj.method...)
+	return strings.Join(append(args, obj.args...), " \\\n  ")
+}
+
+// 把请求参数转换成curl 命令,method 和href 与Request 的参数相同
+//
+// 不包含client 的默认参数,Headers 为空时使用DefaultHeaders。Body 和只有Content 或Reader 的文件无法转换
+func (obj *RequestOption) Curl(method string, href string) (string, error) {
+	option := *obj
+	if option.Body != nil {
+		return "", errors.New("Body 无法转换为curl 命令")
+	}
+	for _, file := range option.Files {
+		if file.Path == "" {
+			return "", errors.New("只有Path 的文件可以转换为curl 命令")
+		}
+	}
+	if option.Method == "" {
+		option.Method = method
+	}
+	if option.Url == nil {
+		var err error
+		if option.Url, err = url.Parse(href); err != nil {
+			return "", tools.WrapError(err, "url 解析错误")
+		}
+	}
+	multi := option.Form != nil || option.Files != nil
+	files := option.Files
+	option.Files = nil //文件使用-F 上传,不需要读取
+	if err := option.optionInit(); err != nil {
+		return "", err
+	}
+	builder := new(curlBuilder)
+	headers := option.Headers.(http.Header).Clone()
+	if option.Host != "" {
+		headers.Set("Host", option.Host)
+	}
+	if headers.Get("Content-Type") == "" && option.ContentType != "" && (!multi || obj.ContentType != "") {
+		headers.Set("Content-Type", option.ContentType)
+	}
+	builder.addHeaders(headers, option.orderHeaders)
+	if option.Cookies != nil {
+		builder.add("-b", option.Cookies.(Cookies).String())
+	}
+	var hasBody bool
+	if multi {
+		hasBody = true
+		dataMap := map[string][]string{}
+		if option.Form != nil {
+			if _, err := newBody(option.Form, formType, dataMap); err != nil {
+				return "", err
+			}
+		}
+		keys := make([]string, 0, len(dataMap))
+		for key := range dataMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, val := range dataMap[key] {
+				builder.add("--form-string", key+"="+val)
+			}
+		}
+		for _, file := range files {
+			val := file.Key + "=@" + file.Path
+			if file.Type != "" {
+				val += ";type=" + file.Type
+			}
+			if file.Name != "" {
+				val += ";filename=" + file.Name
+			}
+			builder.add("-F", val)
+		}
+	} else if option.body != nil {
+		body, err := io.ReadAll(option.body)
+		if err != nil {
+			return "", err
+		}
+		hasBody = len(body) > 0
+		builder.addBody(body)
+	}
+	builder.addMethod(option.Method, hasBody)
+	if headers.Get("Accept-Encoding") != "" && !option.DisUnZip {
+		builder.args = append(builder.args, "--compressed")
+	}
+	if option.DisProxy {
+		builder.add("--noproxy", "*")
+	} else if option.Proxy != "" {
+		builder.add("-x", option.Proxy)
+	}
+	if option.Timeout > 0 {
+		builder.add("-m", strconv.FormatFloat(option.Timeout.Seconds(), 'f', -1, 64))
+	}
+	return builder.String(option.converUrl), nil
+}
+
+// 把请求转换成curl 命令,用于在RequestCallBack 中复现请求,流式上传的body 不包含在内
+func (obj *RequestDebug) Curl() (string, error) {
+	builder := new(curlBuilder)
+	builder.addHeaders(obj.Header, nil)
+	body, err := obj.Body()
+	if err != nil {
+		return "", err
+	}
+	builder.addBody(body.Bytes())
+	builder.addMethod(obj.Method, body.Len() > 0)
+	if obj.Header.Get("Accept-Encoding") != "" {
+		builder.args = append(builder.args, "--compressed")
+	}
+	return builder.String(obj.Url.String()), nil
+}
@@ -0,0 +1,488 @@
+package requests
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justseemore/gospider/bar"
+	"github.com/justseemore/gospider/tools"
+)
+
+type DownloadOption struct {
+	RequestOption                //请求参数,TryNum 同时为读取body 失败后从断点继续的次数
+	Segments       int           //分段并行下载的数量,服务器支持Range 时生效,default:1
+	MinSegmentSize int64         //每段的最小大小,default:1M
+	Checksum       string        //下载完成后校验文件,支持md5,sha1,sha256,sha512,例如:sha256:e3b0c442...
+	DisResume      bool          //关闭断点续传,每次重新下载
+	MetaInterval   time.Duration //保存下载进度的间隔,default:1s
+}
+
+// 下载进度,保存在path.part.json 中,用于断点续传
+type downloadMeta struct {
+	Url          string
+	Size         int64 //文件大小,-1 为未知
+	Range        bool  //服务器是否支持Range
+	ETag         string
+	LastModified string
+	Segments     []*downloadSegment
+}
+type downloadSegment struct {
+	Start int64
+	End   int64 //包含End,-1 为读取到结束
+	Pos   int64 //下一个要写入的位置
+}
+
+func (obj *downloadSegment) done() bool {
+	return obj.End >= 0 && obj.Pos > obj.End
+}
+
+var errDownloadRestart = errors.New("文件已经改变,需要重新下载")
+
+type downloader struct {
+	client   *Client
+	href     string
+	path     string
+	option   DownloadOption
+	headers  http.Header
+	file     *os.File
+	meta     *downloadMeta
+	bar      *bar.Client
+	lock     sync.Mutex
+	saveTime time.Time
+}
+
+// 下载文件到path,直接写入磁盘,支持断点续传和分段并行下载
+func (obj *Client) Download(preCtx context.Context, href string, path string, options ...DownloadOption) error {
+	if preCtx == nil {
+		preCtx = obj.ctx
+	}
+	var option DownloadOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Segments <= 0 {
+		option.Segments = 1
+	}
+	if option.MinSegmentSize <= 0 {
+		option.MinSegmentSize = 1024 * 1024
+	}
+	if option.MetaInterval <= 0 {
+		option.MetaInterval = time.Second
+	}
+	if option.TryNum == 0 {
+		option.TryNum = obj.tryNum
+	}
+	if option.Headers == nil {
+		option.Headers = obj.headers
+	}
+	if err := option.initHeaders(); err != nil {
+		return tools.WrapError(err, "download headers 初始化错误")
+	}
+	headers := option.Headers.(http.Header)
+	headers.Set("Accept-Encoding", "identity") //压缩后无法按位置续传
+	option.DisRead = true
+	option.DisCache = true
+	showBar := option.Bar || obj.bar
+	option.Bar = false
+	if option.Body != nil {
+		return tools.WrapError(ErrFatal, "download 不支持Body")
+	}
+	down := &downloader{
+		client:  obj,
+		href:    href,
+		path:    path,
+		option:  option,
+		headers: headers,
+	}
+	resume := !option.DisResume
+	for {
+		err := down.run(preCtx, resume, showBar)
+		if !errors.Is(err, errDownloadRestart) || !resume {
+			return err
+		}
+		resume = false
+	}
+}
+func (obj *downloader) partPath() string {
+	return obj.path + ".part"
+}
+func (obj *downloader) metaPath() string {
+	return obj.path + ".part.json"
+}
+
+// 加载之前的下载进度
+func (obj *downloader) loadMeta() *downloadMeta {
+	if !tools.PathExist(obj.partPath()) {
+		return nil
+	}
+	con, err := os.ReadFile(obj.metaPath())
+	if err != nil {
+		return nil
+	}
+	var meta downloadMeta
+	if err = tools.JsonUnMarshal(con, &meta); err != nil {
+		return nil
+	}
+	if meta.Url != obj.href || !meta.Range || len(meta.Segments) == 0 {
+		return nil
+	}
+	return &meta
+}
+func (obj *downloader) saveMeta(force bool) error {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if !force && time.Since(obj.saveTime) < obj.option.MetaInterval {
+		return nil
+	}
+	obj.saveTime = time.Now()
+	con, err := tools.JsonMarshal(obj.meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(obj.metaPath(), con, 0644)
+}
+
+// If-Range 的值,弱etag 不能用于Range 请求
+func (obj *downloader) ifRange() string {
+	if obj.meta.ETag != "" && !strings.HasPrefix(obj.meta.ETag, "W/") {
+		return obj.meta.ETag
+	}
+	return obj.meta.LastModified
+}
+func (obj *downloader) fetch(ctx context.Context, start, end int64) (*Response, error) {
+	option := obj.option.RequestOption
+	headers := obj.headers.Clone()
+	if start > 0 || end >= 0 {
+		if end >= 0 {
+			headers.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+		} else {
+			headers.Set("Range", fmt.Sprintf("bytes=%d-", start))
+		}
+		if ifRange := obj.ifRange(); ifRange != "" {
+			headers.Set("If-Range", ifRange)
+		}
+	}
+	option.Headers = headers
+	resp, err := obj.client.Request(ctx, http.MethodGet, obj.href, option)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode() {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp, nil
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		resp.Close()
+		return nil, fmt.Errorf("download 状态码错误: %d", resp.StatusCode())
+	default:
+		resp.Close()
+		return nil, tools.WrapError(ErrFatal, fmt.Sprintf("download 状态码错误: %d", resp.StatusCode()))
+	}
+}
+
+// 解析Content-Range,返回开始位置和文件大小
+func parseContentRange(val string) (int64, int64, bool) {
+	val, ok := strings.CutPrefix(strings.TrimSpace(val), "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	rangeStr, sizeStr, ok := strings.Cut(val, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	startStr, _, ok := strings.Cut(rangeStr, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size := int64(-1)
+	if sizeStr != "*" {
+		if size, err = strconv.ParseInt(sizeStr, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
+
+// 新的下载,根据第一个请求判断文件大小和是否支持Range,然后分段
+func (obj *downloader) newMeta(resp *Response) *downloadMeta {
+	meta := &downloadMeta{
+		Url:          obj.href,
+		Size:         resp.ContentLength(),
+		ETag:         resp.Headers().Get("ETag"),
+		LastModified: resp.Headers().Get("Last-Modified"),
+	}
+	if resp.response.ContentLength < 0 {
+		meta.Size = -1
+	}
+	meta.Range = meta.Size > 0 && strings.Contains(strings.ToLower(resp.Headers().Get("Accept-Ranges")), "bytes")
+	segments := int64(1)
+	if meta.Range {
+		segments = int64(obj.option.Segments)
+		if maxSegments := meta.Size / obj.option.MinSegmentSize; segments > maxSegments {
+			segments = maxSegments
+		}
+		if segments < 1 {
+			segments = 1
+		}
+	}
+	if meta.Size < 0 {
+		meta.Segments = []*downloadSegment{{Start: 0, End: -1}}
+		return meta
+	}
+	segmentSize := (meta.Size + segments - 1) / segments
+	for start := int64(0); start < meta.Size; start += segmentSize {
+		end := start + segmentSize - 1
+		if end >= meta.Size {
+			end = meta.Size - 1
+		}
+		meta.Segments = append(meta.Segments, &downloadSegment{Start: start, End: end, Pos: start})
+	}
+	if len(meta.Segments) == 0 { //空文件
+		meta.Segments = []*downloadSegment{{Start: 0, End: -1}}
+	}
+	return meta
+}
+func (obj *downloader) run(preCtx context.Context, resume bool, showBar bool) (err error) {
+	var firstResp *Response
+	obj.meta = nil
+	if resume {
+		obj.meta = obj.loadMeta()
+	}
+	if obj.meta == nil {
+		if firstResp, err = obj.fetch(preCtx, 0, -1); err != nil {
+			return err
+		}
+		obj.meta = obj.newMeta(firstResp)
+		os.Remove(obj.partPath())
+	}
+	defer func() {
+		if firstResp != nil {
+			firstResp.Close()
+		}
+	}()
+	if obj.file, err = os.OpenFile(obj.partPath(), os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return err
+	}
+	defer obj.file.Close()
+	if err = obj.saveMeta(true); err != nil {
+		return err
+	}
+	obj.bar = nil
+	if showBar && obj.meta.Size > 0 {
+		obj.bar = bar.NewClient(obj.meta.Size, bar.ClientOption{Cur: obj.progress()})
+	}
+	ctx, cnl := context.WithCancel(preCtx)
+	defer cnl()
+	var wait sync.WaitGroup
+	var errOnce sync.Once
+	var segmentErr error
+	for i, segment := range obj.meta.Segments {
+		if segment.done() {
+			continue
+		}
+		var resp *Response
+		if i == 0 && firstResp != nil {
+			resp, firstResp = firstResp, nil
+		}
+		wait.Add(1)
+		go func(segment *downloadSegment, resp *Response) {
+			defer wait.Done()
+			if err := obj.segment(ctx, segment, resp); err != nil {
+				errOnce.Do(func() {
+					segmentErr = err
+					cnl()
+				})
+			}
+		}(segment, resp)
+	}
+	wait.Wait()
+	if segmentErr != nil {
+		obj.saveMeta(true)
+		return segmentErr
+	}
+	return obj.finish()
+}
+
+// 下载一段,读取失败后从已写入的位置继续
+func (obj *downloader) segment(ctx context.Context, segment *downloadSegment, resp *Response) (err error) {
+	defer func() {
+		if resp != nil {
+			resp.Close()
+		}
+	}()
+	var failNum int64
+	for !segment.done() {
+		if resp == nil {
+			if segment.Pos > segment.Start && !obj.meta.Range { //不支持Range,只能重新下载
+				obj.resetSegment(segment)
+			}
+			if resp, err = obj.fetch(ctx, segment.Pos, segment.End); err != nil {
+				if errors.Is(err, ErrFatal) || ctx.Err() != nil {
+					return err
+				}
+				if failNum++; failNum > obj.option.TryNum {
+					return err
+				}
+				continue
+			}
+			if resp.StatusCode() == http.StatusPartialContent {
+				start, size, ok := parseContentRange(resp.Headers().Get("Content-Range"))
+				if !ok || start != segment.Pos || (obj.meta.Size >= 0 && size != obj.meta.Size) {
+					return errDownloadRestart
+				}
+				if etag := resp.Headers().Get("ETag"); etag != "" && obj.meta.ETag != "" && etag != obj.meta.ETag {
+					return errDownloadRestart
+				}
+			} else if segment.Pos > 0 { //服务器返回了完整的文件
+				if len(obj.meta.Segments) > 1 {
+					return errDownloadRestart
+				}
+				obj.resetSegment(segment)
+			}
+		}
+		var reader io.Reader = resp
+		var want int64 = -1
+		if segment.End >= 0 {
+			want = segment.End - segment.Pos + 1
+			reader = io.LimitReader(resp, want)
+		}
+		prePos := segment.Pos
+		_, err = io.Copy(&segmentWriter{downloader: obj, segment: segment}, reader)
+		resp.Close()
+		resp = nil
+		if err == nil && want >= 0 && segment.Pos-prePos < want {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			if segment.End < 0 { //未知大小,读取到结束
+				segment.End = segment.Pos - 1
+			}
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if segment.Pos > prePos { //有进度时重新计算失败次数
+			failNum = 0
+		}
+		if failNum++; failNum > obj.option.TryNum {
+			return err
+		}
+	}
+	return obj.saveMeta(true)
+}
+
+// 已经下载的大小
+func (obj *downloader) progress() int64 {
+	var cur int64
+	for _, segment := range obj.meta.Segments {
+		cur += segment.Pos - segment.Start
+	}
+	return cur
+}
+
+// 丢弃segment 已经下载的内容,重新创建进度条,否则进度会超过100%
+func (obj *downloader) resetSegment(segment *downloadSegment) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	segment.Pos = segment.Start
+	if obj.bar != nil {
+		obj.bar = bar.NewClient(obj.meta.Size, bar.ClientOption{Cur: obj.progress()})
+	}
+}
+
+type segmentWriter struct {
+	downloader *downloader
+	segment    *downloadSegment
+}
+
+func (obj *segmentWriter) Write(con []byte) (int, error) {
+	n, err := obj.downloader.file.WriteAt(con, obj.segment.Pos)
+	obj.downloader.lock.Lock()
+	obj.segment.Pos += int64(n)
+	bar := obj.downloader.bar
+	obj.downloader.lock.Unlock()
+	if bar != nil {
+		bar.Print(int64(n))
+	}
+	if err == nil {
+		err = obj.downloader.saveMeta(false)
+	}
+	return n, err
+}
+
+// 校验文件大小和checksum,完成后重命名
+func (obj *downloader) finish() error {
+	var size int64
+	for _, segment := range obj.meta.Segments {
+		size += segment.End - segment.Start + 1
+	}
+	if obj.meta.Size >= 0 && size != obj.meta.Size {
+		return fmt.Errorf("download 文件大小错误: %d != %d", size, obj.meta.Size)
+	}
+	if err := obj.file.Truncate(size); err != nil {
+		return err
+	}
+	if err := obj.file.Close(); err != nil {
+		return err
+	}
+	if obj.option.Checksum != "" {
+		if err := verifyChecksum(obj.partPath(), obj.option.Checksum); err != nil {
+			os.Remove(obj.partPath())
+			os.Remove(obj.metaPath())
+			return err
+		}
+	}
+	if err := os.Rename(obj.partPath(), obj.path); err != nil {
+		return err
+	}
+	os.Remove(obj.metaPath())
+	return nil
+}
+func verifyChecksum(path string, checksum string) error {
+	algorithm, sum, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return tools.WrapError(ErrFatal, "checksum 格式错误,例如:sha256:e3b0c442...")
+	}
+	var hasher hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		hasher = md5.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	case "sha512":
+		hasher = sha512.New()
+	default:
+		return tools.WrapError(ErrFatal, "不支持的checksum 算法: "+algorithm)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return err
+	}
+	if fileSum := tools.Hex(hasher.Sum(nil)); !strings.EqualFold(fileSum, sum) {
+		return tools.WrapError(ErrFatal, fmt.Sprintf("checksum 校验失败: %s != %s", fileSum, sum))
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package requests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/justseemore/gospider/tools"
+)
+
+// 按rfc8305 排序ip,优先的地址类型在前,两种地址类型交替
+func (obj *DialClient) sortIps(host string, ips []net.IP) []net.IP {
+	if len(ips) == 0 {
+		return ips
+	}
+	var addrType int
+	if obj.addrType != 0 {
+		addrType = int(obj.addrType)
+	} else if obj.getAddrType != nil {
+		addrType = int(obj.getAddrType(host))
+	}
+	if addrType == 0 {
+		addrType = tools.ParseIp(ips[0])
+	}
+	var primarys, fallbacks []net.IP
+	for _, ip := range ips {
+		if tools.ParseIp(ip) == addrType {
+			primarys = append(primarys, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	if obj.rotateIp {
+		index, _ := obj.ipIndexs.LoadOrStore(host, new(atomic.Uint32))
+		num := int(index.(*atomic.Uint32).Add(1) - 1)
+		primarys = rotateIps(primarys, num)
+		fallbacks = rotateIps(fallbacks, num)
+	}
+	results := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(primarys) || i < len(fallbacks); i++ {
+		if i < len(primarys) {
+			results = append(results, primarys[i])
+		}
+		if i < len(fallbacks) {
+			results = append(results, fallbacks[i])
+		}
+	}
+	if obj.getIps != nil {
+		results = obj.getIps(host, results)
+	}
+	return results
+}
+func rotateIps(ips []net.IP, num int) []net.IP {
+	if len(ips) < 2 {
+		return ips
+	}
+	num %= len(ips)
+	return append(ips[num:len(ips):len(ips)], ips[:num]...)
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// happy eyeballs,按顺序连接,上一个ip 在fallbackDelay 内没有连接成功时同时连接下一个ip,返回最先成功的连接
+func (obj *DialClient) dialParallel(ctx context.Context, dialer *net.Dialer, network string, addrs []string) (net.Conn, error) {
+	if len(addrs) == 1 {
+		return dialer.DialContext(ctx, network, addrs[0])
+	}
+	ctx, cnl := context.WithCancel(ctx)
+	defer cnl()
+	results := make(chan dialResult, len(addrs))
+	var started, failed int
+	start := func() {
+		addr := addrs[started]
+		started++
+		go func() {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			results <- dialResult{conn: conn, err: err}
+		}()
+	}
+	start()
+	var firstErr error
+	for {
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if started < len(addrs) && obj.fallbackDelay > 0 {
+			timer = time.NewTimer(obj.fallbackDelay)
+			timerC = timer.C
+		}
+		select {
+		case result := <-results:
+			if timer != nil {
+				timer.Stop()
+			}
+			if result.err == nil {
+				//关闭其它同时连接成功的连接
+				go func(num int) {
+					for i := 0; i < num; i++ {
+						if result := <-results; result.conn != nil {
+							result.conn.Close()
+						}
+					}
+				}(started - failed - 1)
+				return result.conn, nil
+			}
+			failed++
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if started < len(addrs) && ctx.Err() == nil {
+				start()
+			} else if failed == started {
+				return nil, firstErr
+			}
+		case <-timerC:
+			start()
+		}
+	}
+}
+
+// 固定请求连接的ip,修改transport 中请求的url,连接池按ip 区分,不改变sni 和Host
+type pinRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (obj *pinRoundTripper) CloseIdleConnections() {
+	if closeIdler, ok := obj.next.(interface{ CloseIdleConnections() }); ok {
+		closeIdler.CloseIdleConnections()
+	}
+}
+func (obj *pinRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctxData := req.Context().Value(keyPrincipalID).(*reqCtxData)
+	ctxData.pinUrl = nil
+	//重定向到其它host 时正常解析
+	if ctxData.ip == "" || req.URL.Hostname() != ctxData.pinHost {
+		return obj.next.RoundTrip(req)
+	}
+	port := req.URL.Port()
+	if port == "" {
+		if req.URL.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	pinReq := req.Clone(req.Context())
+	pinReq.URL.Host = net.JoinHostPort(ctxData.ip, port)
+	if pinReq.Host == "" {
+		pinReq.Host = req.URL.Host
+	}
+	ctxData.pinUrl = req.URL
+	resp, err := obj.next.RoundTrip(pinReq)
+	if resp != nil {
+		resp.Request = req
+	}
+	return resp, err
+}
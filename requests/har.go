@@ -0,0 +1,471 @@
+package requests
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/justseemore/gospider/ja3"
+	"github.com/justseemore/gospider/tools"
+)
+
+// har 1.2 格式,http://www.softwareishard.com/blog/har-12-spec/
+type Har struct {
+	Log HarLog `json:"log"`
+}
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Entries []HarEntry `json:"entries"`
+}
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+type HarEntry struct {
+	StartedDateTime time.Time      `json:"startedDateTime"`
+	Time            float64        `json:"time"`
+	Request         HarRequest     `json:"request"`
+	Response        HarResponse    `json:"response"`
+	Cache           struct{}       `json:"cache"`
+	Timings         HarTimings     `json:"timings"`
+	ServerIPAddress string         `json:"serverIPAddress,omitempty"`
+	Connection      string         `json:"connection,omitempty"`
+	Ja3             string         `json:"_ja3,omitempty"`       //使用的ja3 指纹
+	H2Ja3Spec       *ja3.H2Ja3Spec `json:"_h2Ja3Spec,omitempty"` //使用的h2 指纹
+}
+type HarRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarCookie    `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarCookie    `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+type HarCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HttpOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"` //base64 编码的二进制内容
+}
+type HarContent struct {
+	Size        int64  `json:"size"`                  //解压后的大小
+	Compression int64  `json:"compression,omitempty"` //压缩节省的大小,传输的大小在HarResponse.BodySize
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+// 单位:毫秒,-1 表示不可用
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	Dns     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	Ssl     float64 `json:"ssl"`
+}
+
+func newHar() *Har {
+	return &Har{Log: HarLog{
+		Version: "1.2",
+		Creator: HarCreator{Name: "gospider", Version: "1.0"},
+		Entries: []HarEntry{},
+	}}
+}
+
+// 加载har 文件
+func LoadHar(path string) (*Har, error) {
+	con, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	har := newHar()
+	if err = tools.JsonUnMarshal(con, har); err != nil {
+		return nil, err
+	}
+	return har, nil
+}
+
+// 保存har 文件
+func (obj *Har) Save(path string) error {
+	con, err := tools.JsonMarshal(obj)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, con, 0644)
+}
+
+// har 记录器,记录client 的每一次请求,包括重定向
+type HarRecorder struct {
+	har  *Har
+	lock sync.Mutex
+}
+
+func NewHarRecorder() *HarRecorder {
+	return &HarRecorder{har: newHar()}
+}
+
+// 返回记录的har
+func (obj *HarRecorder) Har() *Har {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	har := *obj.har
+	har.Log.Entries = tools.CopySlices(obj.har.Log.Entries)
+	return &har
+}
+
+// 保存记录的har 文件
+func (obj *HarRecorder) Save(path string) error {
+	return obj.Har().Save(path)
+}
+
+// 清空记录
+func (obj *HarRecorder) Clear() {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	obj.har.Log.Entries = []HarEntry{}
+}
+func (obj *HarRecorder) add(entry HarEntry) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	obj.har.Log.Entries = append(obj.har.Log.Entries, entry)
+}
+
+type harTimer struct {
+	lock      sync.Mutex
+	start     time.Time
+	dnsStart  time.Time
+	dnsDone   time.Time
+	connStart time.Time
+	connDone  time.Time
+	tlsStart  time.Time
+	tlsDone   time.Time
+	gotConn   time.Time
+	wrote     time.Time
+	firstByte time.Time
+	reused    bool
+	remote    string
+}
+
+func (obj *harTimer) set(t *time.Time) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if t.IsZero() {
+		*t = time.Now()
+	}
+}
+func (obj *harTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { obj.set(&obj.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { obj.set(&obj.dnsDone) },
+		ConnectStart:      func(string, string) { obj.set(&obj.connStart) },
+		ConnectDone:       func(string, string, error) { obj.set(&obj.connDone) },
+		TLSHandshakeStart: func() { obj.set(&obj.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { obj.set(&obj.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			obj.set(&obj.gotConn)
+			obj.lock.Lock()
+			defer obj.lock.Unlock()
+			obj.reused = info.Reused
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				obj.remote = addr.String()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { obj.set(&obj.wrote) },
+		GotFirstResponseByte: func() { obj.set(&obj.firstByte) },
+	}
+}
+func harDuration(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return -1
+	}
+	return float64(end.Sub(start)) / float64(time.Millisecond)
+}
+func (obj *harTimer) timings(end time.Time) HarTimings {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	timings := HarTimings{
+		Dns:     harDuration(obj.dnsStart, obj.dnsDone),
+		Connect: harDuration(obj.connStart, obj.gotConn),
+		Ssl:     harDuration(obj.tlsStart, obj.tlsDone),
+		Send:    harDuration(obj.gotConn, obj.wrote),
+		Wait:    harDuration(obj.wrote, obj.firstByte),
+		Receive: harDuration(obj.firstByte, end),
+	}
+	if obj.reused {
+		timings.Dns, timings.Connect = -1, -1
+	}
+	if timings.Blocked = harDuration(obj.start, obj.dnsStart); timings.Blocked == -1 {
+		timings.Blocked = harDuration(obj.start, obj.gotConn)
+	}
+	for _, val := range []*float64{&timings.Send, &timings.Wait, &timings.Receive} {
+		if *val < 0 {
+			*val = 0
+		}
+	}
+	return timings
+}
+
+type harRoundTripper struct {
+	recorder *HarRecorder
+	next     http.RoundTripper
+	dialer   *DialClient
+	h2Spec   *ja3.H2Ja3Spec
+}
+
+func (obj *harRoundTripper) CloseIdleConnections() {
+	if closeIdler, ok := obj.next.(interface{ CloseIdleConnections() }); ok {
+		closeIdler.CloseIdleConnections()
+	}
+}
+func harHeaders(headers http.Header) []HarNameValue {
+	result := []HarNameValue{}
+	for key, vals := range headers {
+		for _, val := range vals {
+			result = append(result, HarNameValue{Name: key, Value: val})
+		}
+	}
+	return result
+}
+func harCookies(cookies []*http.Cookie) []HarCookie {
+	result := []HarCookie{}
+	for _, cookie := range cookies {
+		harCookie := HarCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HttpOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			expires := cookie.Expires
+			harCookie.Expires = &expires
+		}
+		result = append(result, harCookie)
+	}
+	return result
+}
+func harText(content []byte) (string, string) {
+	if utf8.Valid(content) {
+		return tools.BytesToString(content), ""
+	}
+	return base64.StdEncoding.EncodeToString(content), "base64"
+}
+func (obj *harRoundTripper) newRequest(req *http.Request) HarRequest {
+	harReq := HarRequest{
+		Method:      req.Method,
+		Url:         req.URL.String(),
+		HttpVersion: req.Proto,
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harHeaders(req.Header),
+		QueryString: []HarNameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	for key, vals := range req.URL.Query() {
+		for _, val := range vals {
+			harReq.QueryString = append(harReq.QueryString, HarNameValue{Name: key, Value: val})
+		}
+	}
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			con, err := io.ReadAll(body)
+			body.Close()
+			if err == nil {
+				postData := &HarPostData{MimeType: req.Header.Get("Content-Type")}
+				postData.Text, postData.Encoding = harText(con)
+				harReq.PostData = postData
+				harReq.BodySize = int64(len(con))
+			}
+		}
+	} else if req.Body != nil {
+		harReq.BodySize = -1
+	}
+	return harReq
+}
+
+// har 中记录解压后的内容,解压失败时记录原始内容
+func harDecode(resp *http.Response, content []byte) []byte {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return content
+	}
+	decoded, err := tools.CompressionDecode(context.TODO(), bytes.NewBuffer(content), encoding)
+	if err != nil {
+		return content
+	}
+	return decoded.Bytes()
+}
+func (obj *harRoundTripper) newResponse(resp *http.Response, content []byte) HarResponse {
+	decoded := harDecode(resp, content)
+	harResp := HarResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HttpVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(content)),
+		Content: HarContent{
+			Size:     int64(len(decoded)),
+			MimeType: resp.Header.Get("Content-Type"),
+		},
+	}
+	if compression := len(decoded) - len(content); compression > 0 {
+		harResp.Content.Compression = int64(compression)
+	}
+	if _, text, ok := strings.Cut(resp.Status, " "); ok {
+		harResp.StatusText = text
+	}
+	harResp.Content.Text, harResp.Content.Encoding = harText(decoded)
+	return harResp
+}
+func (obj *harRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	timer := &harTimer{start: time.Now()}
+	entry := HarEntry{
+		StartedDateTime: timer.start,
+		Request:         obj.newRequest(req),
+	}
+	if obj.dialer.ja3 {
+		spec := obj.dialer.ja3Spec
+		if !spec.IsSet() {
+			spec = ja3.DefaultJa3Spec()
+		}
+		entry.Ja3 = spec.String()
+	}
+	entry.H2Ja3Spec = obj.h2Spec
+	resp, err := obj.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace())))
+	if err != nil {
+		return resp, err
+	}
+	done := func(content []byte, complete bool) {
+		end := time.Now()
+		entry.Response = obj.newResponse(resp, content)
+		entry.Timings = timer.timings(end)
+		entry.Time = harDuration(timer.start, end)
+		entry.ServerIPAddress, _, _ = net.SplitHostPort(timer.remote)
+		obj.recorder.add(entry)
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols { //websocket 的body 是连接本身,不能包装
+		done(nil, true)
+	} else {
+		resp.Body = newTeeBody(resp.Body, done)
+	}
+	return resp, nil
+}
+
+type harReplayRoundTripper struct {
+	entries map[string][]HarEntry
+	indexs  map[string]int
+	lock    sync.Mutex
+}
+
+func newHarReplay(har *Har) *harReplayRoundTripper {
+	replay := &harReplayRoundTripper{
+		entries: make(map[string][]HarEntry),
+		indexs:  make(map[string]int),
+	}
+	for _, entry := range har.Log.Entries {
+		key := harReplayKey(entry.Request.Method, entry.Request.Url)
+		replay.entries[key] = append(replay.entries[key], entry)
+	}
+	return replay
+}
+func harReplayKey(method, href string) string {
+	return strings.ToUpper(method) + " " + href
+}
+
+// 同一个请求记录了多次的话,按顺序循环返回
+func (obj *harReplayRoundTripper) entry(req *http.Request) (HarEntry, bool) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	key := harReplayKey(req.Method, req.URL.String())
+	entries, ok := obj.entries[key]
+	if !ok {
+		return HarEntry{}, false
+	}
+	index := obj.indexs[key]
+	obj.indexs[key] = (index + 1) % len(entries)
+	return entries[index], true
+}
+func (obj *harReplayRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry, ok := obj.entry(req)
+	if !ok {
+		return nil, tools.WrapError(ErrFatal, errors.New("har 中没有找到请求: "+req.Method+" "+req.URL.String()))
+	}
+	var content []byte
+	var err error
+	if entry.Response.Content.Encoding == "base64" {
+		if content, err = base64.StdEncoding.DecodeString(entry.Response.Content.Text); err != nil {
+			return nil, tools.WrapError(ErrFatal, err)
+		}
+	} else {
+		content = tools.StringToBytes(entry.Response.Content.Text)
+	}
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+		StatusCode:    entry.Response.Status,
+		Proto:         entry.Response.HttpVersion,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       req,
+	}
+	var protoOk bool
+	if resp.ProtoMajor, resp.ProtoMinor, protoOk = http.ParseHTTPVersion(resp.Proto); !protoOk {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	for _, header := range entry.Response.Headers {
+		if strings.HasPrefix(header.Name, ":") { //http2 的伪头部
+			continue
+		}
+		resp.Header.Add(header.Name, header.Value)
+	}
+	//content.text 是解压后的内容,与原始的编码和长度不一致
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Transfer-Encoding")
+	return resp, nil
+}
@@ -11,6 +11,11 @@ import (
 var UserAgent = `Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Safari/537.36`
 var AcceptLanguage = `"zh-CN,zh;q=0.9"`
 
+// 有序的请求头,发送时保持顺序和大小写,例如:OrderHeaders{{"User-Agent", "xxx"}, {"accept", "*/*"}}
+//
+// 值为空时只用于确定位置,例如:{"Host", ""},{"Cookie", ""},{"Content-Length", ""} 等自动生成的请求头
+type OrderHeaders [][2]string
+
 // 请求操作========================================================================= start
 func DefaultHeaders() http.Header {
 	return http.Header{
@@ -29,6 +34,17 @@ func (obj *RequestOption) initHeaders() error {
 	case http.Header:
 		obj.Headers = headers.Clone()
 		return nil
+	case OrderHeaders:
+		head := http.Header{}
+		obj.orderHeaders = make([]string, len(headers))
+		for i, kv := range headers {
+			if kv[1] != "" {
+				head.Add(kv[0], kv[1])
+			}
+			obj.orderHeaders[i] = kv[0]
+		}
+		obj.Headers = head
+		return nil
 	case gjson.Result:
 		if !headers.IsObject() {
 			return errors.New("new headers error")
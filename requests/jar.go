@@ -0,0 +1,540 @@
+package requests
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justseemore/gospider/redis"
+	"github.com/justseemore/gospider/tools"
+)
+
+type JarFormat int
+
+const (
+	JarJson     JarFormat = iota //gospider 的json 格式
+	JarNetscape                  //netscape cookies.txt 格式,curl,wget 使用
+	JarChrome                    //chrome 插件EditThisCookie 导出的json 格式
+)
+
+// 可以导出的cookie
+type JarCookie struct {
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Domain   string        `json:"domain"`
+	Path     string        `json:"path"`
+	Expires  time.Time     `json:"expires"` //零值为会话cookie
+	Secure   bool          `json:"secure"`
+	HttpOnly bool          `json:"httpOnly"`
+	HostOnly bool          `json:"hostOnly"` //是否只发送给domain 本身,不包括子域名
+	SameSite http.SameSite `json:"sameSite"`
+}
+
+func (obj JarCookie) key() string {
+	return obj.Domain + ";" + obj.Path + ";" + obj.Name
+}
+func (obj JarCookie) expired(now time.Time) bool {
+	return !obj.Expires.IsZero() && !obj.Expires.After(now)
+}
+
+type JarOption struct {
+	File        string        //cookies 变化时自动保存到文件,创建时从文件加载
+	Format      JarFormat     //文件的格式
+	Redis       *redis.Client //cookies 变化时自动保存到redis,创建时从redis加载
+	RedisKey    string        //redis 的key,default:gospiderJar
+	SaveDelay   time.Duration //cookies 变化后延迟保存的时间,期间的修改合并为一次保存,default:1s
+	ErrCallBack func(error)   //自动保存失败时的回调
+}
+
+// cookies 管理,可以列出所有cookies,导入导出,持久化
+type Jar struct {
+	jar    *cookieJar
+	option JarOption
+
+	dirty    bool        //是否有没有保存的修改
+	closed   bool        //关闭后不再自动保存
+	timer    *time.Timer //延迟保存的定时器
+	lock     sync.Mutex
+	saveLock sync.Mutex
+}
+
+// 实现http.CookieJar,在cookiejar 的基础上记录所有的cookies
+type cookieJar struct {
+	jar      *cookiejar.Jar
+	cookies  map[string]JarCookie
+	lock     sync.RWMutex
+	onChange func()
+}
+
+func newJar() *cookieJar {
+	jar, _ := cookiejar.New(nil)
+	return &cookieJar{
+		jar:     jar,
+		cookies: make(map[string]JarCookie),
+	}
+}
+
+func NewJar() *Jar {
+	return &Jar{
+		jar: newJar(),
+	}
+}
+
+// 创建可以持久化的jar,如果文件或者redis 中存在cookies 会先加载,使用完后调用Close 保存最后的修改
+func LoadJar(option JarOption) (*Jar, error) {
+	if option.RedisKey == "" {
+		option.RedisKey = "gospiderJar"
+	}
+	if option.SaveDelay <= 0 {
+		option.SaveDelay = time.Second
+	}
+	jar := &Jar{
+		jar:    newJar(),
+		option: option,
+	}
+	if option.File != "" && tools.PathExist(option.File) {
+		con, err := os.ReadFile(option.File)
+		if err != nil {
+			return nil, err
+		}
+		if err = jar.Unmarshal(con, option.Format); err != nil {
+			return nil, err
+		}
+	} else if option.Redis != nil {
+		if val, err := option.Redis.Get(option.RedisKey); err == nil {
+			if err = jar.Unmarshal(tools.StringToBytes(val), JarJson); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if option.File != "" || option.Redis != nil {
+		jar.jar.onChange = jar.change
+	}
+	return jar, nil
+}
+
+// cookies 变化时只标记,延迟SaveDelay 后在后台保存,期间的修改合并为一次保存
+func (obj *Jar) change() {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	obj.dirty = true
+	if obj.timer == nil && !obj.closed {
+		obj.timer = time.AfterFunc(obj.option.SaveDelay, func() {
+			if err := obj.Flush(); err != nil && obj.option.ErrCallBack != nil {
+				obj.option.ErrCallBack(err)
+			}
+		})
+	}
+}
+
+// 立即保存还没有保存的修改
+func (obj *Jar) Flush() error {
+	obj.saveLock.Lock()
+	defer obj.saveLock.Unlock()
+	obj.lock.Lock()
+	dirty := obj.dirty
+	obj.dirty = false
+	if obj.timer != nil {
+		obj.timer.Stop()
+		obj.timer = nil
+	}
+	obj.lock.Unlock()
+	if !dirty {
+		return nil
+	}
+	if err := obj.save(); err != nil {
+		obj.lock.Lock()
+		obj.dirty = true //下次修改或者Close 时重试
+		obj.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// 停止自动保存,保存还没有保存的修改
+func (obj *Jar) Close() error {
+	obj.lock.Lock()
+	obj.closed = true
+	obj.lock.Unlock()
+	return obj.Flush()
+}
+func (obj *Jar) save() error {
+	if obj.option.File != "" {
+		if err := obj.Save(obj.option.File, obj.option.Format); err != nil {
+			return err
+		}
+	}
+	if obj.option.Redis != nil {
+		con, err := obj.Marshal(JarJson)
+		if err != nil {
+			return err
+		}
+		return obj.option.Redis.Set(obj.option.RedisKey, con, 0)
+	}
+	return nil
+}
+func (obj *Jar) Cookies(href string, cookies ...any) (Cookies, error) {
+	return cookie(obj.jar, href, cookies...)
+}
+func (obj *Jar) ClearCookies() {
+	obj.jar.clear()
+}
+
+// 返回所有没有过期的cookies
+func (obj *Jar) AllCookies() []JarCookie {
+	return obj.jar.all()
+}
+
+// 导出cookies
+func (obj *Jar) Marshal(format JarFormat) ([]byte, error) {
+	cookies := obj.AllCookies()
+	switch format {
+	case JarJson:
+		return tools.JsonMarshal(cookies)
+	case JarNetscape:
+		return marshalNetscape(cookies), nil
+	case JarChrome:
+		return marshalChrome(cookies)
+	default:
+		return nil, errors.New("不支持的cookies 格式")
+	}
+}
+
+// 导入cookies
+func (obj *Jar) Unmarshal(con []byte, format JarFormat) error {
+	var cookies []JarCookie
+	var err error
+	switch format {
+	case JarJson:
+		err = tools.JsonUnMarshal(con, &cookies)
+	case JarNetscape:
+		cookies, err = unmarshalNetscape(con)
+	case JarChrome:
+		cookies, err = unmarshalChrome(con)
+	default:
+		err = errors.New("不支持的cookies 格式")
+	}
+	if err != nil {
+		return err
+	}
+	obj.jar.load(cookies)
+	return nil
+}
+
+// 保存cookies 到文件,先写入临时文件再重命名,不会留下写了一半的文件
+func (obj *Jar) Save(path string, format JarFormat) error {
+	con, err := obj.Marshal(format)
+	if err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write(con)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tempFile.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), path)
+}
+
+// 从文件加载cookies
+func (obj *Jar) Load(path string, format JarFormat) error {
+	con, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return obj.Unmarshal(con, format)
+}
+
+// rfc6265 5.1.4
+func defaultCookiePath(u *url.URL) string {
+	path := u.Path
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+func (obj *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	obj.lock.RLock()
+	jar := obj.jar
+	obj.lock.RUnlock()
+	jar.SetCookies(u, cookies)
+	host := strings.ToLower(u.Hostname())
+	now := time.Now()
+	var changed bool
+	obj.lock.Lock()
+	for _, cook := range cookies {
+		jarCookie := JarCookie{
+			Name:     cook.Name,
+			Value:    cook.Value,
+			Path:     cook.Path,
+			Secure:   cook.Secure,
+			HttpOnly: cook.HttpOnly,
+			SameSite: cook.SameSite,
+		}
+		if domain := strings.TrimPrefix(strings.ToLower(cook.Domain), "."); domain == "" {
+			jarCookie.Domain, jarCookie.HostOnly = host, true
+		} else if host == domain || strings.HasSuffix(host, "."+domain) {
+			jarCookie.Domain = domain
+		} else { //不属于这个host 的cookie,cookiejar 会拒绝
+			continue
+		}
+		if jarCookie.Path == "" || jarCookie.Path[0] != '/' {
+			jarCookie.Path = defaultCookiePath(u)
+		}
+		if cook.MaxAge < 0 {
+			jarCookie.Expires = now
+		} else if cook.MaxAge > 0 {
+			jarCookie.Expires = now.Add(time.Duration(cook.MaxAge) * time.Second)
+		} else if !cook.Expires.IsZero() {
+			jarCookie.Expires = cook.Expires
+		}
+		if jarCookie.expired(now) {
+			if _, ok := obj.cookies[jarCookie.key()]; ok {
+				delete(obj.cookies, jarCookie.key())
+				changed = true
+			}
+		} else if old, ok := obj.cookies[jarCookie.key()]; !ok || old != jarCookie {
+			obj.cookies[jarCookie.key()] = jarCookie
+			changed = true
+		}
+	}
+	onChange := obj.onChange
+	obj.lock.Unlock()
+	if changed && onChange != nil {
+		onChange()
+	}
+}
+func (obj *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	obj.lock.RLock()
+	jar := obj.jar
+	obj.lock.RUnlock()
+	return jar.Cookies(u)
+}
+func (obj *cookieJar) clear() {
+	jar, _ := cookiejar.New(nil)
+	obj.lock.Lock()
+	obj.jar = jar
+	obj.cookies = make(map[string]JarCookie)
+	onChange := obj.onChange
+	obj.lock.Unlock()
+	if onChange != nil {
+		onChange()
+	}
+}
+func (obj *cookieJar) all() []JarCookie {
+	obj.lock.RLock()
+	defer obj.lock.RUnlock()
+	now := time.Now()
+	cookies := []JarCookie{}
+	for _, cook := range obj.cookies {
+		if !cook.expired(now) {
+			cookies = append(cookies, cook)
+		}
+	}
+	sort.Slice(cookies, func(i, j int) bool {
+		return cookies[i].key() < cookies[j].key()
+	})
+	return cookies
+}
+func (obj *cookieJar) load(cookies []JarCookie) {
+	now := time.Now()
+	for _, jarCookie := range cookies {
+		if jarCookie.expired(now) || jarCookie.Domain == "" {
+			continue
+		}
+		jarCookie.Domain = strings.TrimPrefix(strings.ToLower(jarCookie.Domain), ".")
+		if jarCookie.Path == "" {
+			jarCookie.Path = "/"
+		}
+		u := &url.URL{Scheme: "http", Host: jarCookie.Domain, Path: jarCookie.Path}
+		if jarCookie.Secure {
+			u.Scheme = "https"
+		}
+		cook := &http.Cookie{
+			Name:     jarCookie.Name,
+			Value:    jarCookie.Value,
+			Path:     jarCookie.Path,
+			Expires:  jarCookie.Expires,
+			Secure:   jarCookie.Secure,
+			HttpOnly: jarCookie.HttpOnly,
+			SameSite: jarCookie.SameSite,
+		}
+		if !jarCookie.HostOnly {
+			cook.Domain = jarCookie.Domain
+		}
+		obj.SetCookies(u, []*http.Cookie{cook})
+	}
+}
+
+// http://www.cookiecentral.com/faq/#3.5
+func marshalNetscape(cookies []JarCookie) []byte {
+	buf := bytes.NewBufferString("# Netscape HTTP Cookie File\n\n")
+	boolStr := func(val bool) string {
+		if val {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	for _, cook := range cookies {
+		domain := cook.Domain
+		if !cook.HostOnly {
+			domain = "." + domain
+		}
+		if cook.HttpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expires int64
+		if !cook.Expires.IsZero() {
+			expires = cook.Expires.Unix()
+		}
+		fmt.Fprintf(buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, boolStr(!cook.HostOnly), cook.Path, boolStr(cook.Secure), expires, cook.Name, cook.Value)
+	}
+	return buf.Bytes()
+}
+func unmarshalNetscape(con []byte) ([]JarCookie, error) {
+	cookies := []JarCookie{}
+	scanner := bufio.NewScanner(bytes.NewReader(con))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		var httpOnly bool
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line, httpOnly = line[len("#HttpOnly_"):], true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 6 {
+			return nil, errors.New("cookies.txt 格式错误: " + line)
+		}
+		if len(fields) == 6 {
+			fields = append(fields, "")
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, errors.New("cookies.txt 过期时间错误: " + line)
+		}
+		cook := JarCookie{
+			Domain:   fields[0],
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			cook.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, cook)
+	}
+	return cookies, scanner.Err()
+}
+
+type chromeCookie struct {
+	Domain         string  `json:"domain"`
+	ExpirationDate float64 `json:"expirationDate,omitempty"`
+	HostOnly       bool    `json:"hostOnly"`
+	HttpOnly       bool    `json:"httpOnly"`
+	Name           string  `json:"name"`
+	Path           string  `json:"path"`
+	SameSite       string  `json:"sameSite"`
+	Secure         bool    `json:"secure"`
+	Session        bool    `json:"session"`
+	StoreId        string  `json:"storeId"`
+	Value          string  `json:"value"`
+	Id             int     `json:"id"`
+}
+
+func marshalChrome(cookies []JarCookie) ([]byte, error) {
+	chromeCookies := []chromeCookie{}
+	for i, cook := range cookies {
+		chromeCook := chromeCookie{
+			Domain:   cook.Domain,
+			HostOnly: cook.HostOnly,
+			HttpOnly: cook.HttpOnly,
+			Name:     cook.Name,
+			Path:     cook.Path,
+			Secure:   cook.Secure,
+			Session:  cook.Expires.IsZero(),
+			StoreId:  "0",
+			Value:    cook.Value,
+			Id:       i + 1,
+		}
+		if !cook.HostOnly {
+			chromeCook.Domain = "." + cook.Domain
+		}
+		if !chromeCook.Session {
+			chromeCook.ExpirationDate = float64(cook.Expires.UnixMilli()) / 1000
+		}
+		switch cook.SameSite {
+		case http.SameSiteNoneMode:
+			chromeCook.SameSite = "no_restriction"
+		case http.SameSiteLaxMode:
+			chromeCook.SameSite = "lax"
+		case http.SameSiteStrictMode:
+			chromeCook.SameSite = "strict"
+		default:
+			chromeCook.SameSite = "unspecified"
+		}
+		chromeCookies = append(chromeCookies, chromeCook)
+	}
+	return tools.JsonMarshal(chromeCookies)
+}
+func unmarshalChrome(con []byte) ([]JarCookie, error) {
+	var chromeCookies []chromeCookie
+	if err := tools.JsonUnMarshal(con, &chromeCookies); err != nil {
+		return nil, err
+	}
+	cookies := []JarCookie{}
+	for _, chromeCook := range chromeCookies {
+		cook := JarCookie{
+			Domain:   chromeCook.Domain,
+			HostOnly: chromeCook.HostOnly,
+			HttpOnly: chromeCook.HttpOnly,
+			Name:     chromeCook.Name,
+			Path:     chromeCook.Path,
+			Secure:   chromeCook.Secure,
+			Value:    chromeCook.Value,
+		}
+		if !chromeCook.Session && chromeCook.ExpirationDate > 0 {
+			sec, dec := math.Modf(chromeCook.ExpirationDate)
+			cook.Expires = time.Unix(int64(sec), int64(dec*1e9))
+		}
+		switch chromeCook.SameSite {
+		case "no_restriction":
+			cook.SameSite = http.SameSiteNoneMode
+		case "lax":
+			cook.SameSite = http.SameSiteLaxMode
+		case "strict":
+			cook.SameSite = http.SameSiteStrictMode
+		}
+		cookies = append(cookies, cook)
+	}
+	return cookies, nil
+}
@@ -0,0 +1,307 @@
+package requests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// 单个host 的限制
+type HostLimit struct {
+	MaxConns int           //最大并发请求数,0:不限制
+	Rate     float64       //每秒请求数,0:不限制
+	Burst    int           //令牌桶容量,允许的突发请求数,default:1
+	Delay    time.Duration //两次请求之间的最小间隔
+}
+type LimiterOption struct {
+	Default  HostLimit            //默认限制
+	Hosts    map[string]HostLimit //指定host 或可注册域名的限制,例如:www.baidu.com,baidu.com
+	Domain   bool                 //按可注册域名(eTLD+1)合并限制,而不是按host
+	AutoSlow bool                 //收到429,503 时自动降速,成功后逐步恢复
+	MaxSlow  time.Duration        //自动降速时最大的额外间隔,default:60s
+}
+
+// 按host 限制并发和速率
+type Limiter struct {
+	option LimiterOption
+	hosts  map[string]*hostLimiter
+	lock   sync.Mutex
+}
+type hostLimiter struct {
+	limit      HostLimit
+	active     int
+	tokens     float64
+	tokenTime  time.Time
+	lastTime   time.Time
+	slow       time.Duration
+	pauseUntil time.Time
+	notice     chan struct{}
+	lock       sync.Mutex
+}
+
+func NewLimiter(option LimiterOption) *Limiter {
+	if option.MaxSlow == 0 {
+		option.MaxSlow = time.Second * 60
+	}
+	hosts := make(map[string]HostLimit)
+	for host, limit := range option.Hosts {
+		hosts[strings.ToLower(host)] = limit
+	}
+	option.Hosts = hosts
+	return &Limiter{
+		option: option,
+		hosts:  make(map[string]*hostLimiter),
+	}
+}
+
+// 返回host 对应的限制key
+func (obj *Limiter) key(host string) string {
+	host = strings.ToLower(host)
+	if obj.option.Domain {
+		if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+			return domain
+		}
+	}
+	return host
+}
+func (obj *Limiter) getLimit(host string) HostLimit {
+	host = strings.ToLower(host)
+	if limit, ok := obj.option.Hosts[host]; ok {
+		return limit
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		if limit, ok := obj.option.Hosts[domain]; ok {
+			return limit
+		}
+	}
+	return obj.option.Default
+}
+func (obj *Limiter) hostLimiter(host string) *hostLimiter {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	key := obj.key(host)
+	limiter, ok := obj.hosts[key]
+	if !ok {
+		limiter = &hostLimiter{notice: make(chan struct{})}
+		limiter.setLimit(obj.getLimit(host))
+		obj.hosts[key] = limiter
+	}
+	return limiter
+}
+
+// 修改host 或可注册域名的限制,运行时生效
+func (obj *Limiter) SetLimit(host string, limit HostLimit) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	host = strings.ToLower(host)
+	obj.option.Hosts[host] = limit
+	for key, limiter := range obj.hosts {
+		if key == host || strings.HasSuffix(key, "."+host) {
+			limiter.setLimit(obj.getLimit(key))
+		}
+	}
+}
+
+// 修改默认限制,运行时生效
+func (obj *Limiter) SetDefault(limit HostLimit) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	obj.option.Default = limit
+	for key, limiter := range obj.hosts {
+		limiter.setLimit(obj.getLimit(key))
+	}
+}
+
+// 对host 降速,delay 为这段时间内暂停请求
+func (obj *Limiter) Slow(host string, delay time.Duration) {
+	obj.hostLimiter(host).addSlow(delay, obj.option.MaxSlow)
+}
+
+// 等待host 允许请求,请求结束后必须调用release
+func (obj *Limiter) Wait(ctx context.Context, host string) (release func(), err error) {
+	return obj.hostLimiter(host).wait(ctx)
+}
+func (obj *hostLimiter) setLimit(limit HostLimit) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	if obj.limit.Rate == 0 || obj.tokens > float64(limit.Burst) {
+		obj.tokens = float64(limit.Burst)
+	}
+	obj.limit = limit
+	obj.broadcast()
+}
+
+// 通知所有等待者重新检查
+func (obj *hostLimiter) broadcast() {
+	close(obj.notice)
+	obj.notice = make(chan struct{})
+}
+func (obj *hostLimiter) addSlow(delay time.Duration, maxSlow time.Duration) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if obj.slow == 0 {
+		obj.slow = time.Second
+	} else if obj.slow *= 2; obj.slow > maxSlow {
+		obj.slow = maxSlow
+	}
+	if delay > 0 {
+		if pauseUntil := time.Now().Add(delay); pauseUntil.After(obj.pauseUntil) {
+			obj.pauseUntil = pauseUntil
+		}
+	}
+}
+func (obj *hostLimiter) recover() {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if obj.slow /= 2; obj.slow < time.Millisecond*100 {
+		obj.slow = 0
+	}
+}
+
+// 返回需要等待的时间,0 表示可以立即请求
+func (obj *hostLimiter) waitTime(now time.Time) (time.Duration, bool) {
+	if obj.limit.MaxConns > 0 && obj.active >= obj.limit.MaxConns {
+		return 0, false
+	}
+	var wait time.Duration
+	if obj.pauseUntil.After(now) {
+		wait = obj.pauseUntil.Sub(now)
+	}
+	if delay := obj.limit.Delay + obj.slow; delay > 0 && !obj.lastTime.IsZero() {
+		if nextTime := obj.lastTime.Add(delay); nextTime.After(now) && nextTime.Sub(now) > wait {
+			wait = nextTime.Sub(now)
+		}
+	}
+	if obj.limit.Rate > 0 {
+		if !obj.tokenTime.IsZero() {
+			obj.tokens += now.Sub(obj.tokenTime).Seconds() * obj.limit.Rate
+			if obj.tokens > float64(obj.limit.Burst) {
+				obj.tokens = float64(obj.limit.Burst)
+			}
+		}
+		obj.tokenTime = now
+		if obj.tokens < 1 {
+			if tokenWait := time.Duration((1 - obj.tokens) / obj.limit.Rate * float64(time.Second)); tokenWait > wait {
+				wait = tokenWait
+			}
+		}
+	}
+	return wait, true
+}
+func (obj *hostLimiter) wait(ctx context.Context) (func(), error) {
+	for {
+		obj.lock.Lock()
+		now := time.Now()
+		wait, ok := obj.waitTime(now)
+		if ok && wait <= 0 {
+			obj.active++
+			if obj.limit.Rate > 0 {
+				obj.tokens--
+			}
+			obj.lastTime = now
+			obj.lock.Unlock()
+			var once sync.Once
+			return func() {
+				once.Do(obj.release)
+			}, nil
+		}
+		notice := obj.notice
+		obj.lock.Unlock()
+		var timer <-chan time.Time
+		if ok {
+			timer = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-notice:
+		case <-timer:
+		}
+	}
+}
+func (obj *hostLimiter) release() {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	obj.active--
+	obj.broadcast()
+}
+
+// 解析Retry-After,支持秒数和http 时间
+func parseRetryAfter(val string) time.Duration {
+	if val == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if retryTime, err := http.ParseTime(val); err == nil {
+		return time.Until(retryTime)
+	}
+	return 0
+}
+
+type limitRoundTripper struct {
+	limiter *Limiter
+	next    http.RoundTripper
+}
+
+func (obj *limitRoundTripper) CloseIdleConnections() {
+	if closeIdler, ok := obj.next.(interface{ CloseIdleConnections() }); ok {
+		closeIdler.CloseIdleConnections()
+	}
+}
+func (obj *limitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := obj.limiter.hostLimiter(req.URL.Hostname())
+	release, err := limiter.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := obj.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return resp, err
+	}
+	if obj.limiter.option.AutoSlow {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			limiter.addSlow(parseRetryAfter(resp.Header.Get("Retry-After")), obj.limiter.option.MaxSlow)
+		default:
+			if resp.StatusCode < 400 {
+				limiter.recover()
+			}
+		}
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		release()
+		return resp, nil
+	}
+	resp.Body = &releaseBody{body: resp.Body, release: release}
+	return resp, nil
+}
+
+// body 读取完成或关闭时释放
+type releaseBody struct {
+	body    io.ReadCloser
+	release func()
+}
+
+func (obj *releaseBody) Read(b []byte) (n int, err error) {
+	if n, err = obj.body.Read(b); err != nil {
+		obj.release()
+	}
+	return
+}
+func (obj *releaseBody) Close() error {
+	err := obj.body.Close()
+	obj.release()
+	return err
+}
@@ -0,0 +1,235 @@
+package requests
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/justseemore/gospider/http2"
+	"github.com/justseemore/gospider/tools"
+)
+
+type LocalAddrMode int
+
+const (
+	LocalAddrRoundRobin LocalAddrMode = iota //每个请求轮换
+	LocalAddrRandom                          //每个请求随机
+	LocalAddrHost                            //相同host 使用相同的地址
+)
+
+type LocalAddrPoolOption struct {
+	Mode          LocalAddrMode                                            //选择本地地址的方式
+	Addrs         []string                                                 //本地ip 列表
+	Prefix        string                                                   //ip 前缀,例如:2001:db8::/64,从前缀中随机生成地址,需要系统支持绑定这些地址,例如:ip -6 route add local 2001:db8::/64 dev lo
+	PrefixNum     int                                                      //从前缀中生成的地址数量,default:64
+	GetLocalAddr  func(ctx context.Context, href *url.URL) (string, error) //自定义选择本地地址,返回的ip 可以不在列表中,返回空时使用Mode 选择
+	MaxTransports int                                                      //最多保留的连接池数量,超过时关闭最久没有使用的连接池,default:地址数量,最少16
+}
+
+// 本地地址池,用于有多个出口ip 的机器,每个本地地址使用单独的连接池
+type LocalAddrPool struct {
+	option LocalAddrPoolOption
+	addrs  []*net.TCPAddr
+	index  atomic.Uint32
+}
+
+// 创建本地地址池
+func NewLocalAddrPool(option LocalAddrPoolOption) (*LocalAddrPool, error) {
+	if option.PrefixNum == 0 {
+		option.PrefixNum = 64
+	}
+	pool := &LocalAddrPool{option: option}
+	addrs := map[string]struct{}{}
+	for _, addr := range option.Addrs {
+		localAddr, err := parseLocalAddr(addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := addrs[localAddr.IP.String()]; !ok {
+			addrs[localAddr.IP.String()] = struct{}{}
+			pool.addrs = append(pool.addrs, localAddr)
+		}
+	}
+	if option.Prefix != "" {
+		_, prefix, err := net.ParseCIDR(option.Prefix)
+		if err != nil {
+			return nil, tools.WrapError(err, "本地地址前缀错误")
+		}
+		ones, bits := prefix.Mask.Size()
+		//前缀中的地址数量可能少于PrefixNum
+		if bits-ones < 31 && 1<<(bits-ones) < option.PrefixNum {
+			option.PrefixNum = 1 << (bits - ones)
+		}
+		for num, tryNum := 0, 0; num < option.PrefixNum && tryNum < option.PrefixNum*10; tryNum++ {
+			ip := randomPrefixIp(prefix)
+			if _, ok := addrs[ip.String()]; !ok {
+				addrs[ip.String()] = struct{}{}
+				pool.addrs = append(pool.addrs, &net.TCPAddr{IP: ip})
+				num++
+			}
+		}
+	}
+	if len(pool.addrs) == 0 && option.GetLocalAddr == nil {
+		return nil, errors.New("本地地址池为空")
+	}
+	if pool.option.MaxTransports == 0 {
+		pool.option.MaxTransports = max(len(pool.addrs), 16)
+	}
+	return pool, nil
+}
+func parseLocalAddr(addr string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(strings.Trim(addr, "[]"))
+	if ip == nil {
+		return nil, errors.New("本地地址错误: " + addr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.TCPAddr{IP: ip}, nil
+}
+
+// 在前缀中随机生成ip
+func randomPrefixIp(prefix *net.IPNet) net.IP {
+	ip := make(net.IP, len(prefix.IP))
+	for i := range ip {
+		ip[i] = prefix.IP[i] | (byte(rand.Intn(256)) &^ prefix.Mask[i])
+	}
+	return ip
+}
+
+// 池中的地址
+func (obj *LocalAddrPool) Addrs() []string {
+	addrs := make([]string, len(obj.addrs))
+	for i, addr := range obj.addrs {
+		addrs[i] = addr.IP.String()
+	}
+	return addrs
+}
+
+// 选择请求使用的本地地址
+func (obj *LocalAddrPool) GetLocalAddr(ctx context.Context, href *url.URL) (*net.TCPAddr, error) {
+	if obj.option.GetLocalAddr != nil {
+		addr, err := obj.option.GetLocalAddr(ctx, href)
+		if err != nil {
+			return nil, err
+		}
+		if addr != "" {
+			return parseLocalAddr(addr)
+		}
+	}
+	if len(obj.addrs) == 0 {
+		return nil, errors.New("本地地址池为空")
+	}
+	switch obj.option.Mode {
+	case LocalAddrRandom:
+		return obj.addrs[rand.Intn(len(obj.addrs))], nil
+	case LocalAddrHost:
+		hash := fnv.New32a()
+		hash.Write([]byte(href.Hostname()))
+		return obj.addrs[int(hash.Sum32()%uint32(len(obj.addrs)))], nil
+	default:
+		return obj.addrs[int((obj.index.Add(1)-1)%uint32(len(obj.addrs)))], nil
+	}
+}
+
+type localAddrKey struct{}
+
+func withLocalAddr(ctx context.Context, localAddr *net.TCPAddr) context.Context {
+	return context.WithValue(ctx, localAddrKey{}, localAddr)
+}
+func getLocalAddr(ctx context.Context) *net.TCPAddr {
+	localAddr, _ := ctx.Value(localAddrKey{}).(*net.TCPAddr)
+	return localAddr
+}
+
+// 只保留与本地地址类型相同的ip
+func filterAddrs(addrs []string, localAddr *net.TCPAddr) []string {
+	isIpv4 := localAddr.IP.To4() != nil
+	results := []string{}
+	for _, addr := range addrs {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && (ip.To4() != nil) == isIpv4 {
+			results = append(results, addr)
+		}
+	}
+	return results
+}
+
+type localTransport struct {
+	key       string
+	transport *http.Transport
+	http2Upg  *http2.Upg
+}
+
+func (obj *localTransport) closeIdleConnections() {
+	obj.transport.CloseIdleConnections()
+	if obj.http2Upg != nil {
+		obj.http2Upg.CloseIdleConnections()
+	}
+}
+
+// 每个本地地址使用单独的transport,连接池不会混用出口ip,按最近使用的顺序最多保留MaxTransports 个
+type localRoundTripper struct {
+	pool         *LocalAddrPool
+	newTransport func(localAddr *net.TCPAddr) (*http.Transport, *http2.Upg)
+	transports   map[string]*list.Element
+	order        *list.List //最近使用的在前面
+	lock         sync.Mutex
+}
+
+func newLocalRoundTripper(pool *LocalAddrPool, newTransport func(localAddr *net.TCPAddr) (*http.Transport, *http2.Upg)) *localRoundTripper {
+	return &localRoundTripper{
+		pool:         pool,
+		newTransport: newTransport,
+		transports:   make(map[string]*list.Element),
+		order:        list.New(),
+	}
+}
+func (obj *localRoundTripper) transport(localAddr *net.TCPAddr) *localTransport {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	key := localAddr.IP.String()
+	if element, ok := obj.transports[key]; ok {
+		obj.order.MoveToFront(element)
+		return element.Value.(*localTransport)
+	}
+	transport := &localTransport{key: key}
+	transport.transport, transport.http2Upg = obj.newTransport(localAddr)
+	obj.transports[key] = obj.order.PushFront(transport)
+	//正在使用的连接不受影响,请求结束后由IdleConnTimeout 关闭
+	for obj.order.Len() > obj.pool.option.MaxTransports {
+		evicted := obj.order.Remove(obj.order.Back()).(*localTransport)
+		delete(obj.transports, evicted.key)
+		evicted.closeIdleConnections()
+	}
+	return transport
+}
+func (obj *localRoundTripper) CloseIdleConnections() {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	for element := obj.order.Front(); element != nil; element = element.Next() {
+		element.Value.(*localTransport).closeIdleConnections()
+	}
+}
+func (obj *localRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	href := req.URL
+	if ctxData, ok := req.Context().Value(keyPrincipalID).(*reqCtxData); ok && ctxData.pinUrl != nil {
+		href = ctxData.pinUrl
+	}
+	localAddr, err := obj.pool.GetLocalAddr(req.Context(), href)
+	if err != nil {
+		return nil, tools.WrapError(err, "选择本地地址错误")
+	}
+	return obj.transport(localAddr).transport.RoundTrip(req)
+}
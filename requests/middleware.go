@@ -0,0 +1,102 @@
+package requests
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// 执行请求,返回结果
+type Handler func(ctx context.Context, option *RequestOption) (*Response, error)
+
+// 中间件,包装下一个Handler。可以修改option,直接返回自己构造的Response,或者处理返回的Response
+type Middleware func(next Handler) Handler
+
+// 执行中间件链,每次重试和重定向都会经过所有中间件
+func (obj *Client) send(ctx context.Context, option RequestOption) (*Response, error) {
+	if len(option.Middlewares) == 0 {
+		return obj.request(ctx, option)
+	}
+	var handler Handler = func(ctx context.Context, option *RequestOption) (*Response, error) {
+		return obj.request(ctx, *option)
+	}
+	for i := len(option.Middlewares) - 1; i >= 0; i-- {
+		handler = option.Middlewares[i](handler)
+	}
+	maxRedirect := option.RedirectNum //0:不限制,与没有中间件时一致
+	option.RedirectNum = -1           //重定向由中间件链处理
+	for redirectNum := 0; ; redirectNum++ {
+		resp, err := handler(ctx, &option)
+		if err != nil || resp == nil {
+			return resp, err
+		}
+		if maxRedirect < 0 || (maxRedirect > 0 && redirectNum >= maxRedirect) {
+			return resp, nil
+		}
+		nextOption, ok := redirectOption(option, resp)
+		if !ok {
+			return resp, nil
+		}
+		resp.Close()
+		option = nextOption
+	}
+}
+
+// 根据重定向的response 构造下一个请求的option,参照net/http 的重定向规则
+func redirectOption(option RequestOption, resp *Response) (RequestOption, bool) {
+	if resp.response == nil || resp.webSocket != nil {
+		return option, false
+	}
+	var keepBody bool
+	switch resp.StatusCode() {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method := strings.ToUpper(option.Method); method != http.MethodGet && method != http.MethodHead {
+			option.Method = http.MethodGet
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if option.readOnce() { //body 无法重复读取
+			return option, false
+		}
+		keepBody = true
+	default:
+		return option, false
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return option, false
+	}
+	if !keepBody {
+		option.Data = nil
+		option.Json = nil
+		option.Form = nil
+		option.Files = nil
+		option.Raw = nil
+		option.Text = nil
+		option.Body = nil
+		option.ContentType = ""
+	}
+	if err = option.initHeaders(); err != nil {
+		return option, false
+	}
+	headers := option.Headers.(http.Header)
+	preUrl := resp.Url()
+	if location.Hostname() != preUrl.Hostname() { //跨域名时不发送认证信息
+		headers.Del("Authorization")
+		headers.Del("Www-Authenticate")
+		headers.Del("Cookie")
+		headers.Del("Cookie2")
+		option.Cookies = nil
+		option.Auth = nil
+	}
+	if preUrl.Scheme == "https" && location.Scheme == "http" {
+		headers.Del("Referer")
+	} else {
+		referer := cloneUrl(preUrl)
+		referer.User, referer.Fragment = nil, ""
+		headers.Set("Referer", referer.String())
+	}
+	option.Url = location
+	option.Params = nil
+	option.Host = ""
+	return option, true
+}
@@ -3,14 +3,12 @@ package requests
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"io"
 	"mime/multipart"
-	"net/textproto"
 	"net/url"
-	"strings"
 	"time"
 
+	"github.com/justseemore/gospider/tools"
 	"github.com/justseemore/gospider/websocket"
 )
 
@@ -19,9 +17,10 @@ type RequestOption struct {
 	Method      string        //method
 	Url         *url.URL      //请求的url
 	Host        string        //网站的host
-	Proxy       string        //代理,支持http,https,socks5协议代理,例如：http://127.0.0.1:7005
+	Ip          string        //固定连接的ip,不改变sni 和Host,重定向到其它host 时正常解析
+	Proxy       string        //代理,支持http,https,socks5,socks5h,socks4,socks4a协议代理,例如：http://127.0.0.1:7005,多个代理用逗号分隔时为链式代理
 	Timeout     time.Duration //请求超时时间
-	Headers     any           //请求头,支持：json,map，header
+	Headers     any           //请求头,支持：json,map，header,OrderHeaders
 	Cookies     any           // cookies,支持json,map,str，http.Header
 	Files       []File        //发送multipart/form-data,文件上传
 	Params      any           //url 中的参数，用以拼接url,支持json,map
@@ -35,10 +34,12 @@ type RequestOption struct {
 	Raw         any            //不设置context-type,支持string,[]bytes,json,map
 	TempData    map[string]any //临时变量，用于回调存储或自由度更高的用法
 	DisCookie   bool           //关闭cookies管理,这个请求不用cookies池
+	DisCache    bool           //关闭http缓存,这个请求不使用缓存
 	DisDecode   bool           //关闭自动解码
 	Bar         bool           //是否开启bar
 	DisProxy    bool           //是否关闭代理,强制关闭代理
 	TryNum      int64          //重试次数
+	RetryPolicy RetryPolicy    //重试策略,设置后由策略决定是否重试以及重试间隔
 
 	OptionCallBack func(context.Context, *RequestOption) error //请求参数回调,用于对请求参数进行修改。返回error,中断重试请求,返回nil继续
 	ResultCallBack func(context.Context, *Response) error      //结果回调,用于对结果进行校验。返回nil，直接返回,返回err的话，如果有errCallBack 走errCallBack，没有继续try
@@ -47,14 +48,19 @@ type RequestOption struct {
 	RequestCallBack  func(context.Context, *RequestDebug) error  //request回调,用于定位bug,正常请求不要设置这个函数
 	ResponseCallBack func(context.Context, *ResponseDebug) error //response回调,用于定位bug,正常请求不要设置这个函数
 
-	Jar *Jar //自定义临时cookies 管理
+	Jar  *Jar //自定义临时cookies 管理
+	Auth Auth //认证,在transport 中签名,可以读取最终的headers 和body,例如:NewDigestAuth,NewOAuth2Auth,NewAwsAuth
+
+	Middlewares []Middleware //中间件,在client 的中间件之后执行,每次重试和重定向都会执行
 
 	RedirectNum int              //重定向次数,小于零 关闭重定向
 	DisRead     bool             //关闭默认读取请求体,不会主动读取body里面的内容，需用你自己读取
 	DisUnZip    bool             //关闭自动解压
 	WsOption    websocket.Option //websocket option,使用websocket 请求的option
 
-	converUrl string
+	converUrl     string
+	contentLength int64    //流式body 的长度,大于0时设置Content-Length
+	orderHeaders  []string //请求头的顺序和大小写,来自OrderHeaders
 }
 
 func (obj *RequestOption) initBody() (err error) {
@@ -64,67 +70,16 @@ func (obj *RequestOption) initBody() (err error) {
 		if obj.body, err = newBody(obj.Raw, rawType, nil); err != nil {
 			return err
 		}
-	} else if obj.Form != nil {
+	} else if obj.Form != nil || obj.Files != nil {
 		dataMap := map[string][]string{}
-		if obj.body, err = newBody(obj.Form, formType, dataMap); err != nil {
-			return err
-		}
-		tempBody := bytes.NewBuffer(nil)
-		writer := multipart.NewWriter(tempBody)
-		for key, vals := range dataMap {
-			for _, val := range vals {
-				if err = writer.WriteField(key, val); err != nil {
-					return err
-				}
-			}
-		}
-		escapeQuotes := strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
-		for _, file := range obj.Files {
-			h := make(textproto.MIMEHeader)
-			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes.Replace(file.Key), escapeQuotes.Replace(file.Name)))
-			if file.Type == "" {
-				h.Set("Content-Type", "application/octet-stream")
-			} else {
-				h.Set("Content-Type", file.Type)
-			}
-			if wp, err := writer.CreatePart(h); err != nil {
-				return err
-			} else if _, err = wp.Write(file.Content); err != nil {
+		if obj.Form != nil {
+			if _, err = newBody(obj.Form, formType, dataMap); err != nil {
 				return err
 			}
 		}
-		if err = writer.Close(); err != nil {
+		if err = obj.initMultipart(dataMap); err != nil {
 			return err
 		}
-		if obj.ContentType == "" {
-			obj.ContentType = writer.FormDataContentType()
-		}
-		obj.body = tempBody
-	} else if obj.Files != nil {
-		tempBody := bytes.NewBuffer(nil)
-		writer := multipart.NewWriter(tempBody)
-		escapeQuotes := strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
-		for _, file := range obj.Files {
-			h := make(textproto.MIMEHeader)
-			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes.Replace(file.Key), escapeQuotes.Replace(file.Name)))
-			if file.Type == "" {
-				h.Set("Content-Type", "application/octet-stream")
-			} else {
-				h.Set("Content-Type", file.Type)
-			}
-			if wp, err := writer.CreatePart(h); err != nil {
-				return err
-			} else if _, err = wp.Write(file.Content); err != nil {
-				return err
-			}
-		}
-		if err = writer.Close(); err != nil {
-			return err
-		}
-		if obj.ContentType == "" {
-			obj.ContentType = writer.FormDataContentType()
-		}
-		obj.body = tempBody
 	} else if obj.Data != nil {
 		if obj.body, err = newBody(obj.Data, dataType, nil); err != nil {
 			return err
@@ -149,6 +104,55 @@ func (obj *RequestOption) initBody() (err error) {
 	}
 	return nil
 }
+
+// 构造multipart body,有Path 或Reader 的文件时流式上传
+func (obj *RequestOption) initMultipart(dataMap map[string][]string) error {
+	var stream bool
+	for _, file := range obj.Files {
+		if file.stream() {
+			stream = true
+			break
+		}
+	}
+	if !stream {
+		tempBody := bytes.NewBuffer(nil)
+		writer := multipart.NewWriter(tempBody)
+		if err := writeMultipart(writer, dataMap, obj.Files); err != nil {
+			return err
+		}
+		if obj.ContentType == "" {
+			obj.ContentType = writer.FormDataContentType()
+		}
+		obj.body = tempBody
+		return nil
+	}
+	boundary := multipart.NewWriter(nil).Boundary()
+	size, err := multipartSize(boundary, dataMap, obj.Files)
+	if err != nil {
+		return err
+	}
+	if obj.body, err = newMultipartBody(boundary, dataMap, obj.Files, size, obj.Bar); err != nil {
+		return err
+	}
+	if obj.ContentType == "" {
+		obj.ContentType = "multipart/form-data; boundary=" + boundary
+	}
+	obj.contentLength = size
+	return nil
+}
+
+// body 是否只能读取一次,只能读取一次时不能重试和重定向
+func (obj *RequestOption) readOnce() bool {
+	if obj.Body != nil {
+		return true
+	}
+	for _, file := range obj.Files {
+		if file.Reader != nil {
+			return true
+		}
+	}
+	return false
+}
 func (obj *RequestOption) optionInit() error {
 	obj.converUrl = obj.Url.String()
 	var err error
@@ -183,6 +187,15 @@ func (obj *Client) newRequestOption(option RequestOption) RequestOption {
 	if option.TryNum == 0 {
 		option.TryNum = obj.tryNum
 	}
+	if len(obj.middlewares) > 0 {
+		option.Middlewares = append(tools.CopySlices(obj.middlewares), option.Middlewares...)
+	}
+	if option.RetryPolicy == nil {
+		option.RetryPolicy = obj.retryPolicy
+	}
+	if option.Auth == nil {
+		option.Auth = obj.auth
+	}
 	if option.OptionCallBack == nil {
 		option.OptionCallBack = obj.optionCallBack
 	}
@@ -0,0 +1,205 @@
+package requests
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/justseemore/gospider/ja3"
+)
+
+// 浏览器指纹配置,同时设置tls 指纹,http2 指纹和请求头,保证各个指纹一致,名称中的版本与tls 指纹的版本相同
+type Profile struct {
+	Name      string            //名称,例如:chrome114
+	Ja3Spec   ja3.Ja3Spec       //tls 指纹,优先使用
+	Ja3Id     ja3.ClientHelloId //tls 指纹,没有Ja3Spec 时每个client 使用Ja3Id 重新生成,例如:ja3.HelloChrome_114_Padding_PSK_Shuf
+	H2Ja3Spec ja3.H2Ja3Spec     //http2 指纹,包括settings,connection flow,priority 和伪标头顺序
+	Headers   OrderHeaders      //默认的请求头和顺序,包括User-Agent 和client hints
+}
+
+// 返回配置中的User-Agent
+func (obj Profile) UserAgent() string {
+	for _, kv := range obj.Headers {
+		if http.CanonicalHeaderKey(kv[0]) == "User-Agent" {
+			return kv[1]
+		}
+	}
+	return ""
+}
+func (obj Profile) ja3Spec() (ja3.Ja3Spec, error) {
+	if obj.Ja3Spec.IsSet() {
+		return obj.Ja3Spec, nil
+	}
+	if obj.Ja3Id.Client != "" {
+		return ja3.CreateSpecWithId(obj.Ja3Id)
+	}
+	return ja3.Ja3Spec{}, nil
+}
+
+// 内置配置的版本受限于utls 中已有的client hello,没有chrome 116 和firefox 117,
+// 需要时使用ja3.CreateSpecWithStr 生成Ja3Spec,设置H2Ja3Spec 和Headers 后用RegisterProfile 注册
+const (
+	ProfileChrome114  = "chrome114"    //chrome 114 windows
+	ProfileEdge114    = "edge114"      //edge 114 windows
+	ProfileFirefox105 = "firefox105"   //firefox 105 windows
+	ProfileSafari16   = "safari16_ios" //safari 16 ios
+)
+
+var profiles = map[string]Profile{}
+var profileLock sync.RWMutex
+
+// 注册浏览器指纹配置,相同名称的配置会被覆盖
+func RegisterProfile(profile Profile) error {
+	if profile.Name == "" {
+		return errors.New("profile name is empty")
+	}
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	profiles[profile.Name] = profile
+	return nil
+}
+
+// 根据名称获取浏览器指纹配置
+func GetProfile(name string) (Profile, bool) {
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	profile, ok := profiles[name]
+	if ok {
+		profile.Headers = append(OrderHeaders{}, profile.Headers...)
+	}
+	return profile, ok
+}
+
+// 返回所有注册的配置名称,内置:chrome114,edge114,firefox105,safari16_ios,没有更新的版本是因为utls 中没有对应的client hello
+func Profiles() []string {
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chromium 内核的http2 指纹
+func chromiumH2Ja3Spec() ja3.H2Ja3Spec {
+	return ja3.H2Ja3Spec{
+		InitialSetting: []ja3.Setting{
+			{Id: 1, Val: 65536},
+			{Id: 2, Val: 0},
+			{Id: 4, Val: 6291456},
+			{Id: 6, Val: 262144},
+		},
+		ConnFlow:     15663105,
+		OrderHeaders: []string{":method", ":authority", ":scheme", ":path"},
+		Priority: ja3.Priority{
+			Exclusive: true,
+			StreamDep: 0,
+			Weight:    255,
+		},
+	}
+}
+
+// chromium 内核的请求头
+func chromiumHeaders(secChUa string, userAgent string) OrderHeaders {
+	return OrderHeaders{
+		{"Host", ""},
+		{"Connection", "keep-alive"},
+		{"sec-ch-ua", secChUa},
+		{"sec-ch-ua-mobile", "?0"},
+		{"sec-ch-ua-platform", `"Windows"`},
+		{"Upgrade-Insecure-Requests", "1"},
+		{"User-Agent", userAgent},
+		{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+		{"Sec-Fetch-Site", "none"},
+		{"Sec-Fetch-Mode", "navigate"},
+		{"Sec-Fetch-User", "?1"},
+		{"Sec-Fetch-Dest", "document"},
+		{"Accept-Encoding", "gzip, deflate, br"},
+		{"Accept-Language", "en-US,en;q=0.9"},
+		{"Cookie", ""},
+	}
+}
+func init() {
+	profiles[ProfileChrome114] = Profile{
+		Name:      ProfileChrome114,
+		Ja3Id:     ja3.HelloChrome_114_Padding_PSK_Shuf,
+		H2Ja3Spec: chromiumH2Ja3Spec(),
+		Headers: chromiumHeaders(
+			`"Not.A/Brand";v="8", "Chromium";v="114", "Google Chrome";v="114"`,
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36",
+		),
+	}
+	profiles[ProfileEdge114] = Profile{
+		Name:      ProfileEdge114,
+		Ja3Id:     ja3.HelloChrome_114_Padding_PSK_Shuf,
+		H2Ja3Spec: chromiumH2Ja3Spec(),
+		Headers: chromiumHeaders(
+			`"Not.A/Brand";v="8", "Chromium";v="114", "Microsoft Edge";v="114"`,
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36 Edg/114.0.1823.82",
+		),
+	}
+	profiles[ProfileFirefox105] = Profile{
+		Name:  ProfileFirefox105,
+		Ja3Id: ja3.HelloFirefox_105,
+		H2Ja3Spec: ja3.H2Ja3Spec{
+			InitialSetting: []ja3.Setting{
+				{Id: 1, Val: 65536},
+				{Id: 4, Val: 131072},
+				{Id: 5, Val: 16384},
+			},
+			ConnFlow:     12517377,
+			OrderHeaders: []string{":method", ":path", ":authority", ":scheme"},
+			Priority: ja3.Priority{
+				Exclusive: false,
+				StreamDep: 13,
+				Weight:    41,
+			},
+		},
+		Headers: OrderHeaders{
+			{"Host", ""},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:105.0) Gecko/20100101 Firefox/105.0"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{"Accept-Language", "en-US,en;q=0.5"},
+			{"Accept-Encoding", "gzip, deflate, br"},
+			{"Connection", "keep-alive"},
+			{"Cookie", ""},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+	}
+	profiles[ProfileSafari16] = Profile{
+		Name:  ProfileSafari16,
+		Ja3Id: ja3.HelloSafari_16_0,
+		H2Ja3Spec: ja3.H2Ja3Spec{
+			InitialSetting: []ja3.Setting{
+				{Id: 4, Val: 4194304},
+				{Id: 3, Val: 100},
+			},
+			ConnFlow:     10485760,
+			OrderHeaders: []string{":method", ":scheme", ":path", ":authority"},
+			Priority: ja3.Priority{
+				Exclusive: false,
+				StreamDep: 0,
+				Weight:    254,
+			},
+		},
+		Headers: OrderHeaders{
+			{"Host", ""},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Cookie", ""},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1"},
+			{"Accept-Encoding", "gzip, deflate, br"},
+			{"Connection", "keep-alive"},
+		},
+	}
+}
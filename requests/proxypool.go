@@ -0,0 +1,450 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justseemore/gospider/redis"
+)
+
+type ProxyMode int
+
+const (
+	ProxyRoundRobin ProxyMode = iota //轮询
+	ProxyRandom                      //随机
+	ProxyWeight                      //按权重和评分随机
+)
+
+type ProxyPoolOption struct {
+	Mode          ProxyMode                                       //选择代理的方式
+	Proxys        []string                                        //代理列表,没有协议时使用Scheme,多个代理用逗号分隔时为链式代理
+	Weights       map[string]int                                  //代理的权重,default:1
+	Scheme        string                                          //没有协议的代理使用的协议,default:http
+	MaxFail       int                                             //连续失败次数达到后禁用代理,default:3
+	BanTime       time.Duration                                   //禁用时间,default:5分钟
+	CheckUrl      string                                          //健康检查的地址,为空时不检查,检查失败的代理禁用到下次检查成功
+	CheckInterval time.Duration                                   //健康检查间隔,default:60s
+	CheckTimeout  time.Duration                                   //健康检查超时时间,default:10s
+	CheckStatus   func(statusCode int) bool                       //健康检查的状态码是否成功,default:2xx 和3xx,代理返回的407,502,503 等为失败
+	StickyTime    time.Duration                                   //粘性会话的保持时间,default:10分钟
+	StickyKey     func(ctx context.Context, href *url.URL) string //返回粘性会话的key,相同key 使用相同代理,也可以使用WithProxyKey
+	Redis         *redis.Client                                   //从redis 加载代理,格式与redis.GetProxyDatas 相同
+	RedisKey      string                                          //redis 代理的key
+	RedisInterval time.Duration                                   //从redis 刷新代理的间隔,default:60s
+}
+
+// 代理的状态
+type ProxyStat struct {
+	Proxy   string
+	Weight  int
+	Success int64         //成功次数
+	Fail    int64         //失败次数
+	Latency time.Duration //平均延迟
+	Score   float64       //评分,0-1,越大越好
+	Banned  bool          //是否被禁用
+}
+
+type poolProxy struct {
+	proxy    string
+	weight   int
+	success  int64
+	fail     int64
+	failNum  int //连续失败次数
+	latency  time.Duration
+	banUntil time.Time
+}
+
+// 评分,由成功率和延迟计算
+func (obj *poolProxy) score() float64 {
+	rate := float64(obj.success+1) / float64(obj.success+obj.fail+2)
+	return rate / (1 + obj.latency.Seconds())
+}
+func (obj *poolProxy) banned(now time.Time) bool {
+	return obj.banUntil.After(now)
+}
+
+type stickyProxy struct {
+	proxy  string
+	expire time.Time
+}
+
+// 代理池,使用GetProxy 选择代理,可以直接传给ClientOption.GetProxy 或者Client.SetGetProxy
+type ProxyPool struct {
+	option  ProxyPoolOption
+	proxys  []*poolProxy
+	index   int
+	stickys map[string]stickyProxy
+	client  *Client
+	lock    sync.Mutex
+	ctx     context.Context
+	cnl     context.CancelFunc
+}
+
+type proxyKey string
+
+const keyProxy proxyKey = "gospiderProxyKey"
+
+// 设置粘性会话的key,相同key 的请求使用相同的代理
+func WithProxyKey(ctx context.Context, key string) context.Context {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	return context.WithValue(ctx, keyProxy, key)
+}
+
+func NewProxyPool(preCtx context.Context, option ProxyPoolOption) (*ProxyPool, error) {
+	if preCtx == nil {
+		preCtx = context.TODO()
+	}
+	if option.Scheme == "" {
+		option.Scheme = "http"
+	}
+	if option.MaxFail == 0 {
+		option.MaxFail = 3
+	}
+	if option.BanTime == 0 {
+		option.BanTime = time.Minute * 5
+	}
+	if option.CheckInterval == 0 {
+		option.CheckInterval = time.Second * 60
+	}
+	if option.CheckTimeout == 0 {
+		option.CheckTimeout = time.Second * 10
+	}
+	if option.CheckStatus == nil {
+		option.CheckStatus = func(statusCode int) bool {
+			return statusCode >= 200 && statusCode < 400
+		}
+	}
+	if option.StickyTime == 0 {
+		option.StickyTime = time.Minute * 10
+	}
+	if option.RedisInterval == 0 {
+		option.RedisInterval = time.Second * 60
+	}
+	ctx, cnl := context.WithCancel(preCtx)
+	pool := &ProxyPool{
+		option:  option,
+		stickys: make(map[string]stickyProxy),
+		ctx:     ctx,
+		cnl:     cnl,
+	}
+	for _, proxy := range option.Proxys {
+		if err := pool.Add(proxy, option.Weights[proxy]); err != nil {
+			cnl()
+			return nil, err
+		}
+	}
+	if option.Redis != nil {
+		if err := pool.loadRedis(); err != nil {
+			cnl()
+			return nil, err
+		}
+		go pool.run(option.RedisInterval, func() { pool.loadRedis() })
+	}
+	if option.CheckUrl != "" {
+		client, err := NewClient(ctx, ClientOption{DisCookie: true})
+		if err != nil {
+			cnl()
+			return nil, err
+		}
+		pool.client = client
+		pool.Check() //创建时先检查一次,不会返回没有检查过的代理
+		go pool.run(option.CheckInterval, pool.Check)
+	}
+	return pool, nil
+}
+func (obj *ProxyPool) run(interval time.Duration, fun func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-obj.ctx.Done():
+			return
+		case <-ticker.C:
+			fun()
+		}
+	}
+}
+
+// 关闭代理池,停止健康检查和redis 刷新
+func (obj *ProxyPool) Close() {
+	obj.cnl()
+	if obj.client != nil {
+		obj.client.Close()
+	}
+}
+
+// 统一代理的格式,方便统计时与DialClient 中的代理对应
+func (obj *ProxyPool) parseProxy(proxy string) (string, error) {
+	proxys := strings.Split(proxy, ",")
+	for i, proxy := range proxys {
+		if proxy = strings.TrimSpace(proxy); !strings.Contains(proxy, "://") {
+			proxy = obj.option.Scheme + "://" + proxy
+		}
+		proxys[i] = proxy
+	}
+	proxyUrls, err := verifyProxys(strings.Join(proxys, ","))
+	if err != nil {
+		return "", err
+	}
+	return proxysString(proxyUrls, false), nil
+}
+
+// 添加代理,已经存在时修改权重
+func (obj *ProxyPool) Add(proxy string, weight int) error {
+	proxy, err := obj.parseProxy(proxy)
+	if err != nil {
+		return err
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	for _, poolProxy := range obj.proxys {
+		if poolProxy.proxy == proxy {
+			poolProxy.weight = weight
+			return nil
+		}
+	}
+	obj.proxys = append(obj.proxys, &poolProxy{proxy: proxy, weight: weight})
+	return nil
+}
+
+// 删除代理
+func (obj *ProxyPool) Del(proxy string) {
+	proxy, err := obj.parseProxy(proxy)
+	if err != nil {
+		return
+	}
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	for i, poolProxy := range obj.proxys {
+		if poolProxy.proxy == proxy {
+			obj.proxys = append(obj.proxys[:i], obj.proxys[i+1:]...)
+			return
+		}
+	}
+}
+
+// 使用redis 中的代理替换代理池,保留已有代理的统计
+func (obj *ProxyPool) loadRedis() error {
+	datas, err := obj.option.Redis.GetProxyDatas(obj.option.RedisKey)
+	if err != nil {
+		return err
+	}
+	proxys := []*poolProxy{}
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	olds := make(map[string]*poolProxy)
+	for _, poolProxy := range obj.proxys {
+		olds[poolProxy.proxy] = poolProxy
+	}
+	for _, data := range datas {
+		proxy, err := obj.parseProxy(data.Proxy)
+		if err != nil {
+			return err
+		}
+		if old, ok := olds[proxy]; ok {
+			proxys = append(proxys, old)
+		} else {
+			weight := obj.option.Weights[data.Proxy]
+			if weight <= 0 {
+				weight = 1
+			}
+			proxys = append(proxys, &poolProxy{proxy: proxy, weight: weight})
+		}
+	}
+	obj.proxys = proxys
+	return nil
+}
+func (obj *ProxyPool) getProxy(proxy string) *poolProxy {
+	for _, poolProxy := range obj.proxys {
+		if poolProxy.proxy == proxy {
+			return poolProxy
+		}
+	}
+	return nil
+}
+
+// 选择一个代理,可以直接作为ClientOption.GetProxy 使用
+func (obj *ProxyPool) GetProxy(ctx context.Context, href *url.URL) (string, error) {
+	var key string
+	if ctx != nil {
+		key, _ = ctx.Value(keyProxy).(string)
+	}
+	if key == "" && obj.option.StickyKey != nil {
+		key = obj.option.StickyKey(ctx, href)
+	}
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	now := time.Now()
+	if key != "" {
+		if sticky, ok := obj.stickys[key]; ok && sticky.expire.After(now) {
+			if poolProxy := obj.getProxy(sticky.proxy); poolProxy != nil && !poolProxy.banned(now) {
+				obj.stickys[key] = stickyProxy{proxy: sticky.proxy, expire: now.Add(obj.option.StickyTime)}
+				return sticky.proxy, nil
+			}
+		}
+		for stickyKey, sticky := range obj.stickys { //清理过期的会话
+			if !sticky.expire.After(now) {
+				delete(obj.stickys, stickyKey)
+			}
+		}
+	}
+	proxy, err := obj.choose(now)
+	if err != nil {
+		return "", err
+	}
+	if key != "" {
+		obj.stickys[key] = stickyProxy{proxy: proxy, expire: now.Add(obj.option.StickyTime)}
+	}
+	return proxy, nil
+}
+func (obj *ProxyPool) choose(now time.Time) (string, error) {
+	proxys := []*poolProxy{}
+	for _, poolProxy := range obj.proxys {
+		if !poolProxy.banned(now) {
+			proxys = append(proxys, poolProxy)
+		}
+	}
+	if len(proxys) == 0 {
+		return "", errors.New("没有可用的代理")
+	}
+	switch obj.option.Mode {
+	case ProxyRandom:
+		return proxys[rand.Intn(len(proxys))].proxy, nil
+	case ProxyWeight:
+		var total float64
+		for _, poolProxy := range proxys {
+			total += float64(poolProxy.weight) * poolProxy.score()
+		}
+		val := rand.Float64() * total
+		for _, poolProxy := range proxys {
+			if val -= float64(poolProxy.weight) * poolProxy.score(); val < 0 {
+				return poolProxy.proxy, nil
+			}
+		}
+		return proxys[len(proxys)-1].proxy, nil
+	default:
+		obj.index++
+		return proxys[obj.index%len(proxys)].proxy, nil
+	}
+}
+
+// 报告代理请求成功,latency 为延迟
+func (obj *ProxyPool) Success(proxy string, latency time.Duration) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	poolProxy := obj.getProxy(proxy)
+	if poolProxy == nil {
+		return
+	}
+	poolProxy.success++
+	poolProxy.failNum = 0
+	poolProxy.banUntil = time.Time{}
+	if poolProxy.latency == 0 {
+		poolProxy.latency = latency
+	} else {
+		poolProxy.latency = (poolProxy.latency*7 + latency*3) / 10
+	}
+}
+
+// 报告代理请求失败,连续失败MaxFail 次后禁用BanTime
+func (obj *ProxyPool) Fail(proxy string) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	poolProxy := obj.getProxy(proxy)
+	if poolProxy == nil {
+		return
+	}
+	poolProxy.fail++
+	if poolProxy.failNum++; poolProxy.failNum >= obj.option.MaxFail {
+		poolProxy.failNum = 0
+		poolProxy.banUntil = time.Now().Add(obj.option.BanTime)
+	}
+}
+
+// 健康检查失败,直接禁用
+func (obj *ProxyPool) ban(proxy string) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	poolProxy := obj.getProxy(proxy)
+	if poolProxy == nil {
+		return
+	}
+	poolProxy.fail++
+	poolProxy.failNum = 0
+	poolProxy.banUntil = time.Now().Add(max(obj.option.BanTime, obj.option.CheckInterval))
+}
+
+// 返回所有代理的状态
+func (obj *ProxyPool) Stats() []ProxyStat {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	now := time.Now()
+	stats := make([]ProxyStat, len(obj.proxys))
+	for i, poolProxy := range obj.proxys {
+		stats[i] = ProxyStat{
+			Proxy:   poolProxy.proxy,
+			Weight:  poolProxy.weight,
+			Success: poolProxy.success,
+			Fail:    poolProxy.fail,
+			Latency: poolProxy.latency,
+			Score:   poolProxy.score(),
+			Banned:  poolProxy.banned(now),
+		}
+	}
+	return stats
+}
+
+// 对所有代理进行一次健康检查
+func (obj *ProxyPool) Check() {
+	if obj.client == nil {
+		return
+	}
+	obj.lock.Lock()
+	proxys := make([]string, len(obj.proxys))
+	for i, poolProxy := range obj.proxys {
+		proxys[i] = poolProxy.proxy
+	}
+	obj.lock.Unlock()
+	var wait sync.WaitGroup
+	limit := make(chan struct{}, 20)
+	for _, proxy := range proxys {
+		wait.Add(1)
+		limit <- struct{}{}
+		go func(proxy string) {
+			defer func() {
+				<-limit
+				wait.Done()
+			}()
+			startTime := time.Now()
+			resp, err := obj.client.Request(obj.ctx, "get", obj.option.CheckUrl, RequestOption{
+				Proxy:       proxy,
+				Timeout:     obj.option.CheckTimeout,
+				DisRead:     true,
+				RedirectNum: -1,
+			})
+			if err != nil {
+				if obj.ctx.Err() == nil {
+					obj.ban(proxy)
+				}
+				return
+			}
+			resp.Close()
+			if obj.option.CheckStatus(resp.StatusCode()) {
+				obj.Success(proxy, time.Since(startTime))
+			} else {
+				obj.ban(proxy)
+			}
+		}(proxy)
+	}
+	wait.Wait()
+}
@@ -7,13 +7,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 	_ "unsafe"
 
+	"github.com/justseemore/gospider/http2"
 	"github.com/justseemore/gospider/re"
 	"github.com/justseemore/gospider/tools"
 	"github.com/justseemore/gospider/websocket"
@@ -152,7 +156,7 @@ var (
 
 type reqCtxData struct {
 	isCallback       bool
-	proxy            *url.URL
+	proxys           []*url.URL
 	url              *url.URL
 	host             string
 	redirectNum      int
@@ -161,6 +165,15 @@ type reqCtxData struct {
 	requestCallBack  func(context.Context, *RequestDebug) error
 	disBody          bool
 	responseCallBack func(context.Context, *ResponseDebug) error
+	disCache         bool
+	cacheStatus      CacheStatus
+	auth             Auth
+	authHost         string
+	trace            *TraceInfo
+	orderHeaders     []string
+	ip               string   //固定连接的ip
+	pinHost          string   //固定ip 的host
+	pinUrl           *url.URL //固定ip 时原始的url
 }
 
 func Get(preCtx context.Context, href string, options ...RequestOption) (*Response, error) {
@@ -254,12 +267,13 @@ func (obj *Client) Request(preCtx context.Context, method string, href string, o
 		rawOption = options[0]
 	}
 	optionBak := obj.newRequestOption(rawOption)
-	if rawOption.Body != nil && optionBak.TryNum > 0 {
+	if rawOption.readOnce() {
 		optionBak.TryNum = 0
+		optionBak.RetryPolicy = nil
 	}
 	//开始请求
 	var tryNum int64
-	for tryNum = 0; tryNum <= optionBak.TryNum; tryNum++ {
+	for tryNum = 0; tryNum <= optionBak.TryNum || optionBak.RetryPolicy != nil; tryNum++ {
 		select {
 		case <-obj.ctx.Done():
 			obj.Close()
@@ -268,6 +282,7 @@ func (obj *Client) Request(preCtx context.Context, method string, href string, o
 		case <-preCtx.Done():
 			return nil, tools.WrapError(preCtx.Err(), "request ctx 错误")
 		default:
+			tryCtx := context.WithValue(preCtx, keyTryNum, tryNum)
 			option := optionBak
 			if option.Method == "" {
 				option.Method = method
@@ -279,26 +294,40 @@ func (obj *Client) Request(preCtx context.Context, method string, href string, o
 				}
 			}
 			if option.OptionCallBack != nil {
-				if err = option.OptionCallBack(preCtx, &option); err != nil {
+				if err = option.OptionCallBack(tryCtx, &option); err != nil {
 					return
 				}
 			}
-			resp, err = obj.request(preCtx, option)
+			resp, err = obj.send(tryCtx, option)
 			if err != nil { //有错误
 				if errors.Is(err, ErrFatal) { //致命错误直接返回
 					return
-				} else if option.ErrCallBack != nil && option.ErrCallBack(preCtx, err) != nil { //不是致命错误，有错误回调,有错误,直接返回
+				} else if option.ErrCallBack != nil && option.ErrCallBack(tryCtx, err) != nil { //不是致命错误，有错误回调,有错误,直接返回
 					return
 				}
 			} else if option.ResultCallBack == nil { //没有错误，且没有回调，直接返回
-				return
-			} else if err = option.ResultCallBack(preCtx, resp); err != nil { //没有错误，有回调，回调错误
-				if option.ErrCallBack != nil && option.ErrCallBack(preCtx, err) != nil { //有错误回调,有错误直接返回
+				if option.RetryPolicy == nil {
+					return
+				}
+			} else if err = option.ResultCallBack(tryCtx, resp); err != nil { //没有错误，有回调，回调错误
+				if option.ErrCallBack != nil && option.ErrCallBack(tryCtx, err) != nil { //有错误回调,有错误直接返回
 					return
 				}
 			} else { //没有错误，有回调，没有回调错误，直接返回
 				return
 			}
+			if option.RetryPolicy != nil { //重试策略决定是否重试以及等待时间
+				delay, retry := option.RetryPolicy.Retry(tryCtx, tryNum+1, resp, err)
+				if !retry {
+					return
+				}
+				if resp != nil {
+					resp.Close()
+				}
+				if err = retryWait(preCtx, delay); err != nil {
+					return resp, tools.WrapError(err, "request ctx 错误")
+				}
+			}
 		}
 	}
 	if err != nil { //有错误直接返回错误
@@ -312,12 +341,44 @@ func verifyProxy(proxyUrl string) (*url.URL, error) {
 		return nil, err
 	}
 	switch proxy.Scheme {
-	case "http", "socks5", "https":
+	case "http", "https", "socks5", "socks5h", "socks4", "socks4a":
 		return proxy, nil
 	default:
 		return nil, tools.WrapError(ErrFatal, "不支持的代理协议")
 	}
 }
+
+// 解析代理,多个代理用逗号分隔时为链式代理,按顺序连接
+func verifyProxys(proxy string) ([]*url.URL, error) {
+	var proxys []*url.URL
+	for _, proxyUrl := range strings.Split(proxy, ",") {
+		if proxyUrl = strings.TrimSpace(proxyUrl); proxyUrl == "" {
+			continue
+		}
+		tempProxy, err := verifyProxy(proxyUrl)
+		if err != nil {
+			return nil, err
+		}
+		proxys = append(proxys, tempProxy)
+	}
+	if len(proxys) == 0 {
+		return nil, tools.WrapError(ErrFatal, "代理为空")
+	}
+	return proxys, nil
+}
+
+// 代理的字符串,链式代理用逗号连接
+func proxysString(proxys []*url.URL, redacted bool) string {
+	proxyStrs := make([]string, len(proxys))
+	for i, proxy := range proxys {
+		if redacted {
+			proxyStrs[i] = proxy.Redacted()
+		} else {
+			proxyStrs[i] = proxy.String()
+		}
+	}
+	return strings.Join(proxyStrs, ",")
+}
 func (obj *Client) request(preCtx context.Context, option RequestOption) (response *Response, err error) {
 	if err = option.optionInit(); err != nil {
 		err = tools.WrapError(err, "option 初始化错误")
@@ -330,18 +391,29 @@ func (obj *Client) request(preCtx context.Context, option RequestOption) (respon
 	ctxData := new(reqCtxData)
 	ctxData.requestCallBack = option.RequestCallBack
 	ctxData.responseCallBack = option.ResponseCallBack
-	if option.Body != nil {
+	if _, stream := option.body.(*multipartBody); stream || option.Body != nil {
 		ctxData.disBody = true
 	}
 	ctxData.disProxy = option.DisProxy
+	ctxData.disCache = option.DisCache
+	ctxData.auth = option.Auth
+	ctxData.trace = &TraceInfo{StartTime: time.Now()}
+	ctxData.orderHeaders = option.orderHeaders
+	if option.Ip != "" {
+		ip := net.ParseIP(strings.Trim(option.Ip, "[]"))
+		if ip == nil {
+			return response, tools.WrapError(ErrFatal, "ip 格式错误: "+option.Ip)
+		}
+		ctxData.ip = ip.String()
+	}
 	if option.Proxy != "" { //代理相关构造
-		tempProxy, err := verifyProxy(option.Proxy)
+		tempProxys, err := verifyProxys(option.Proxy)
 		if err != nil {
 			return response, tools.WrapError(ErrFatal, errors.New("tempRequest 构造代理失败"), err)
 		}
-		ctxData.proxy = tempProxy
-	} else if tempProxy := obj.dialer.Proxy(); tempProxy != nil {
-		ctxData.proxy = tempProxy
+		ctxData.proxys = tempProxys
+	} else if tempProxys := obj.dialer.Proxys(); len(tempProxys) > 0 {
+		ctxData.proxys = tempProxys
 	}
 	if option.RedirectNum != 0 { //重定向次数
 		ctxData.redirectNum = option.RedirectNum
@@ -354,6 +426,10 @@ func (obj *Client) request(preCtx context.Context, option RequestOption) (respon
 	} else {
 		reqCtx, cancel = context.WithCancel(context.WithValue(preCtx, keyPrincipalID, ctxData))
 	}
+	reqCtx = httptrace.WithClientTrace(reqCtx, ctxData.clientTrace(obj.dialer))
+	if option.orderHeaders != nil { //http2 请求头的顺序
+		reqCtx = http2.WithOrderHeaders(reqCtx, option.orderHeaders)
+	}
 	defer func() {
 		if err != nil {
 			cancel()
@@ -371,8 +447,12 @@ func (obj *Client) request(preCtx context.Context, option RequestOption) (respon
 	if err != nil {
 		return response, tools.WrapError(ErrFatal, errors.New("tempRequest 构造request失败"), err)
 	}
+	if option.contentLength > 0 {
+		reqs.ContentLength = option.contentLength
+	}
 	ctxData.url = reqs.URL
 	ctxData.host = reqs.Host
+	ctxData.pinHost = reqs.URL.Hostname()
 	if reqs.URL.Scheme == "file" {
 		filePath := re.Sub(`^/+`, "", reqs.URL.Path)
 		fileContent, err := os.ReadFile(filePath)
@@ -426,7 +506,9 @@ func (obj *Client) request(preCtx context.Context, option RequestOption) (respon
 		websocket.SetClientHeaders(reqs.Header, option.WsOption)
 	}
 	r, err = obj.getClient(option).Do(reqs)
+	ctxData.trace.Total = time.Since(ctxData.trace.StartTime)
 	if r != nil {
+		ctxData.trace.Proto = r.Proto
 		isSse := r.Header.Get("Content-Type") == "text/event-stream"
 
 		if ctxData.responseCallBack != nil {
@@ -447,7 +529,7 @@ func (obj *Client) request(preCtx context.Context, option RequestOption) (respon
 		} else if isSse {
 			option.DisRead = true
 		}
-		if response, err2 = obj.newResponse(reqCtx, cancel, r, option); err2 != nil { //创建 response
+		if response, err2 = obj.newResponse(reqCtx, cancel, r, option, ctxData); err2 != nil { //创建 response
 			return response, err2
 		}
 		if ctxData.ws && r.StatusCode == 101 {
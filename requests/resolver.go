@@ -0,0 +1,348 @@
+package requests
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justseemore/gospider/tools"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dns 解析,返回ip 和记录的ttl,ttl 为0时使用DnsCacheTime
+type Resolver interface {
+	LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+}
+
+// 系统的dns 解析,没有ttl
+type systemResolver struct {
+	resolver *net.Resolver
+}
+
+func (obj *systemResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	addrs, err := obj.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, 0, nil
+}
+
+// 发送dns 请求,返回dns 响应
+type dnsExchange func(ctx context.Context, msg []byte) ([]byte, error)
+
+func newDnsQuery(host string, typ dnsmessage.Type) (uint16, []byte, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return 0, nil, err
+	}
+	id := uint16(rand.Intn(1 << 16))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	con, err := msg.Pack()
+	return id, con, err
+}
+func parseDnsAnswer(id uint16, con []byte) ([]net.IP, time.Duration, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(con); err != nil {
+		return nil, 0, err
+	}
+	if msg.Header.ID != id {
+		return nil, 0, errors.New("dns 响应id 错误")
+	}
+	if msg.Header.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, errors.New("dns 响应错误: " + msg.Header.RCode.String())
+	}
+	var ips []net.IP
+	var ttl time.Duration
+	for _, answer := range msg.Answers {
+		var ip net.IP
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = net.IP(body.A[:])
+		case *dnsmessage.AAAAResource:
+			ip = net.IP(body.AAAA[:])
+		default:
+			continue
+		}
+		ips = append(ips, ip)
+		if recordTtl := time.Duration(answer.Header.TTL) * time.Second; ttl == 0 || recordTtl < ttl {
+			ttl = recordTtl
+		}
+	}
+	return ips, ttl, nil
+}
+
+// 同时查询A 和AAAA 记录,ttl 取最小值
+func lookupWithExchange(ctx context.Context, host string, exchange dnsExchange) ([]net.IP, time.Duration, error) {
+	type result struct {
+		ips []net.IP
+		ttl time.Duration
+		err error
+	}
+	types := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	results := make([]result, len(types))
+	var wg sync.WaitGroup
+	for i, typ := range types {
+		wg.Add(1)
+		go func(i int, typ dnsmessage.Type) {
+			defer wg.Done()
+			id, query, err := newDnsQuery(host, typ)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			con, err := exchange(ctx, query)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			results[i].ips, results[i].ttl, results[i].err = parseDnsAnswer(id, con)
+		}(i, typ)
+	}
+	wg.Wait()
+	var ips []net.IP
+	var ttl time.Duration
+	var err error
+	for _, result := range results {
+		if result.err != nil {
+			err = result.err
+			continue
+		}
+		ips = append(ips, result.ips...)
+		if result.ttl > 0 && (ttl == 0 || result.ttl < ttl) {
+			ttl = result.ttl
+		}
+	}
+	if len(ips) == 0 {
+		if err == nil {
+			err = errors.New("dns 没有解析到ip: " + host)
+		}
+		return nil, 0, err
+	}
+	return ips, ttl, nil
+}
+
+type udpResolver struct {
+	addr   string
+	dialer net.Dialer
+}
+
+// 普通的udp dns,例如:8.8.8.8,8.8.8.8:53
+func NewUdpResolver(addr string) Resolver {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return &udpResolver{addr: addr}
+}
+func (obj *udpResolver) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	conn, err := obj.dialer.DialContext(ctx, "udp", obj.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Second * 5))
+	}
+	if _, err = conn.Write(msg); err != nil {
+		return nil, err
+	}
+	con := make([]byte, 65535)
+	n, err := conn.Read(con)
+	if err != nil {
+		return nil, err
+	}
+	return con[:n], nil
+}
+func (obj *udpResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	return lookupWithExchange(ctx, host, obj.exchange)
+}
+
+type dotResolver struct {
+	addr   string
+	config *tls.Config
+	dialer net.Dialer
+}
+
+// dns over tls,例如:1.1.1.1,dns.google:853,serverName 为空时使用addr 中的host
+func NewDotResolver(addr string, serverName string) Resolver {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "853")
+	}
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(addr)
+	}
+	return &dotResolver{addr: addr, config: &tls.Config{ServerName: serverName}}
+}
+func (obj *dotResolver) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	dialer := &tls.Dialer{NetDialer: &obj.dialer, Config: obj.config}
+	conn, err := dialer.DialContext(ctx, "tcp", obj.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Second * 5))
+	}
+	//tcp 的dns 消息前有两个字节的长度
+	if _, err = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...)); err != nil {
+		return nil, err
+	}
+	lengthCon := make([]byte, 2)
+	if _, err = io.ReadFull(conn, lengthCon); err != nil {
+		return nil, err
+	}
+	con := make([]byte, binary.BigEndian.Uint16(lengthCon))
+	if _, err = io.ReadFull(conn, con); err != nil {
+		return nil, err
+	}
+	return con, nil
+}
+func (obj *dotResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	return lookupWithExchange(ctx, host, obj.exchange)
+}
+
+type dohResolver struct {
+	href        string
+	client      *Client
+	closeClient bool
+}
+
+// dns over https,rfc8484,例如:https://1.1.1.1/dns-query,使用client 发送请求,client 为nil 时创建开启ja3 的client
+//
+// 返回的resolver 实现了io.Closer,关闭时只关闭自己创建的client
+func NewDohResolver(href string, client *Client) (Resolver, error) {
+	if _, err := url.Parse(href); err != nil {
+		return nil, err
+	}
+	resolver := &dohResolver{href: href, client: client}
+	if client == nil {
+		var err error
+		if resolver.client, err = NewClient(nil, ClientOption{Ja3: true, DisCookie: true}); err != nil {
+			return nil, err
+		}
+		resolver.closeClient = true
+	}
+	return resolver, nil
+}
+func (obj *dohResolver) Close() error {
+	if obj.closeClient {
+		obj.client.Close()
+	}
+	return nil
+}
+func (obj *dohResolver) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	resp, err := obj.client.Request(ctx, "post", obj.href, RequestOption{
+		Raw:         msg,
+		ContentType: "application/dns-message",
+		Headers:     map[string]string{"Accept": "application/dns-message"},
+		DisCache:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 {
+		return nil, errors.New("doh 响应错误: " + resp.Status())
+	}
+	return resp.Content(), nil
+}
+func (obj *dohResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	return lookupWithExchange(ctx, host, obj.exchange)
+}
+
+type failoverResolver struct {
+	resolvers []Resolver
+}
+
+// 按顺序使用resolver,失败时使用下一个
+func NewFailoverResolver(resolvers ...Resolver) Resolver {
+	return &failoverResolver{resolvers: resolvers}
+}
+
+// 关闭实现了io.Closer 的resolver
+func (obj *failoverResolver) Close() error {
+	var err error
+	for _, resolver := range obj.resolvers {
+		if closer, ok := resolver.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+func (obj *failoverResolver) LookupIP(ctx context.Context, host string) (ips []net.IP, ttl time.Duration, err error) {
+	if len(obj.resolvers) == 0 {
+		return nil, 0, errors.New("没有可用的resolver")
+	}
+	for _, resolver := range obj.resolvers {
+		if ips, ttl, err = resolver.LookupIP(ctx, host); err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+	}
+	return nil, 0, tools.WrapError(err, "所有resolver 解析失败")
+}
+
+// 根据地址创建resolver,多个地址用逗号分隔,按顺序失败转移,有doh 时返回的resolver 实现了io.Closer,不再使用时需要关闭
+//
+//	8.8.8.8,udp://8.8.8.8:53:udp
+//	tls://1.1.1.1,tls://dns.google:853:dns over tls
+//	https://1.1.1.1/dns-query:dns over https
+func ParseResolver(dns string) (Resolver, error) {
+	var addrs []string
+	for _, addr := range strings.Split(dns, ",") { //先检查所有地址,避免创建了doh 后再返回错误
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if strings.Contains(addr, "://") && !strings.HasPrefix(addr, "https://") && !strings.HasPrefix(addr, "tls://") && !strings.HasPrefix(addr, "udp://") {
+			return nil, errors.New("不支持的dns: " + addr)
+		}
+		addrs = append(addrs, addr)
+	}
+	var resolvers []Resolver
+	for _, addr := range addrs {
+		var resolver Resolver
+		switch {
+		case strings.HasPrefix(addr, "https://"):
+			var err error
+			if resolver, err = NewDohResolver(addr, nil); err != nil {
+				NewFailoverResolver(resolvers...).(io.Closer).Close()
+				return nil, err
+			}
+		case strings.HasPrefix(addr, "tls://"):
+			resolver = NewDotResolver(strings.TrimPrefix(addr, "tls://"), "")
+		case strings.HasPrefix(addr, "udp://"):
+			resolver = NewUdpResolver(strings.TrimPrefix(addr, "udp://"))
+		default:
+			resolver = NewUdpResolver(addr)
+		}
+		resolvers = append(resolvers, resolver)
+	}
+	if len(resolvers) == 0 {
+		return nil, errors.New("dns 为空")
+	}
+	if len(resolvers) == 1 {
+		return resolvers[0], nil
+	}
+	return NewFailoverResolver(resolvers...), nil
+}
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/justseemore/gospider/bar"
 	"github.com/justseemore/gospider/bs4"
@@ -31,6 +32,9 @@ type Response struct {
 	disUnzip  bool
 	filePath  string
 	bar       bool
+
+	cacheStatus CacheStatus
+	trace       *TraceInfo
 }
 
 type SseClient struct {
@@ -72,8 +76,8 @@ func (obj *SseClient) Recv() (Event, error) {
 	}
 }
 
-func (obj *Client) newResponse(ctx context.Context, cnl context.CancelFunc, r *http.Response, request_option RequestOption) (*Response, error) {
-	response := &Response{response: r, ctx: ctx, cnl: cnl, bar: request_option.Bar}
+func (obj *Client) newResponse(ctx context.Context, cnl context.CancelFunc, r *http.Response, request_option RequestOption, ctxData *reqCtxData) (*Response, error) {
+	response := &Response{response: r, ctx: ctx, cnl: cnl, bar: request_option.Bar, cacheStatus: ctxData.cacheStatus, trace: ctxData.trace}
 	if request_option.DisRead { //是否预读
 		return response, nil
 	}
@@ -155,6 +159,16 @@ func (obj *Response) SseClient() *SseClient {
 	}
 }
 
+// 是否直接使用了缓存
+func (obj *Response) FromCache() bool {
+	return obj.cacheStatus == CacheHit
+}
+
+// 是否经过服务器验证后使用了缓存
+func (obj *Response) Revalidated() bool {
+	return obj.cacheStatus == CacheRevalidated
+}
+
 // 返回当前的Location
 func (obj *Response) Location() (*url.URL, error) {
 	return obj.response.Location()
@@ -323,6 +337,12 @@ func (obj *Response) Read(con []byte) (int, error) { //读取body
 
 func (obj *Response) read() error { //读取body,对body 解压，解码操作
 	defer obj.Close()
+	if obj.trace != nil {
+		startTime := time.Now()
+		defer func() {
+			obj.trace.Body = time.Since(startTime)
+		}()
+	}
 	var bBody *bytes.Buffer
 	var err error
 	if obj.bar && obj.ContentLength() > 0 { //是否打印进度条,读取内容
@@ -351,6 +371,14 @@ func (obj *Response) read() error { //读取body,对body 解压，解码操作
 	return nil
 }
 
+// 返回请求的耗时和连接信息
+func (obj *Response) Trace() TraceInfo {
+	if obj.trace == nil {
+		return TraceInfo{}
+	}
+	return *obj.trace
+}
+
 // 关闭response ,当disRead 为true 请一定要手动关闭
 func (obj *Response) Close() error {
 	if obj.cnl != nil {
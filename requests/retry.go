@@ -0,0 +1,189 @@
+package requests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// 重试策略
+type RetryPolicy interface {
+	//tryNum 为已经请求的次数,从1 开始,resp,err 为这次请求的结果。返回重试前的等待时间以及是否重试
+	Retry(ctx context.Context, tryNum int64, resp *Response, err error) (time.Duration, bool)
+}
+
+type tryNumKey string
+
+const keyTryNum tryNumKey = "gospiderTryNum"
+
+// 返回当前是第几次重试,0 为第一次请求,用于回调中判断
+func GetTryNum(ctx context.Context) int64 {
+	if ctx == nil {
+		return 0
+	}
+	tryNum, _ := ctx.Value(keyTryNum).(int64)
+	return tryNum
+}
+
+type ErrType int
+
+const (
+	ErrTypeUnknown ErrType = iota //未知错误
+	ErrTypeDns                    //dns 解析错误
+	ErrTypeDial                   //建立连接错误
+	ErrTypeTls                    //tls 握手错误
+	ErrTypeTimeout                //超时
+	ErrTypeReset                  //连接被重置或意外关闭
+	ErrTypeCancel                 //主动取消
+	ErrTypeProxy                  //代理拒绝连接或认证失败,使用errors.As 获取ProxyError
+)
+
+// 对请求错误进行分类
+func GetErrType(err error) ErrType {
+	if err == nil {
+		return ErrTypeUnknown
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrTypeCancel
+	}
+	var proxyErr *ProxyError
+	if errors.As(err, &proxyErr) {
+		return ErrTypeProxy
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrTypeDns
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return ErrTypeTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTypeTimeout
+	}
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certErr x509.CertificateInvalidError
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &certErr) {
+		return ErrTypeTls
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return ErrTypeReset
+	}
+	var opErr *net.OpError
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) ||
+		(errors.As(err, &opErr) && opErr.Op == "dial") {
+		return ErrTypeDial
+	}
+	errStr := err.Error()
+	switch {
+	case strings.Contains(errStr, "tls:") || strings.Contains(errStr, "handshake"):
+		return ErrTypeTls
+	case strings.Contains(errStr, "connection reset"):
+		return ErrTypeReset
+	default:
+		return ErrTypeUnknown
+	}
+}
+
+type BackoffOption struct {
+	MaxTry      int64         //最大重试次数,default:3
+	Base        time.Duration //第一次重试的等待时间,之后每次翻倍,default:1s
+	Max         time.Duration //最大等待时间,default:30s
+	DisJitter   bool          //关闭随机抖动
+	StatusCodes []int         //需要重试的状态码,default:429,500,502,503,504
+	ErrTypes    []ErrType     //需要重试的错误类型,default:dns,dial,tls,timeout,reset
+}
+type backoffRetry struct {
+	option BackoffOption
+}
+
+// 指数退避重试策略,429,503 时优先使用Retry-After
+func NewBackoffRetry(options ...BackoffOption) RetryPolicy {
+	var option BackoffOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.MaxTry == 0 {
+		option.MaxTry = 3
+	}
+	if option.Base == 0 {
+		option.Base = time.Second
+	}
+	if option.Max == 0 {
+		option.Max = time.Second * 30
+	}
+	if option.StatusCodes == nil {
+		option.StatusCodes = []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+	if option.ErrTypes == nil {
+		option.ErrTypes = []ErrType{ErrTypeDns, ErrTypeDial, ErrTypeTls, ErrTypeTimeout, ErrTypeReset}
+	}
+	return &backoffRetry{option: option}
+}
+func (obj *backoffRetry) Retry(ctx context.Context, tryNum int64, resp *Response, err error) (time.Duration, bool) {
+	if tryNum > obj.option.MaxTry {
+		return 0, false
+	}
+	if err != nil {
+		if resp == nil && !slices.Contains(obj.option.ErrTypes, GetErrType(err)) {
+			return 0, false
+		}
+	} else if resp == nil || !slices.Contains(obj.option.StatusCodes, resp.StatusCode()) {
+		return 0, false
+	}
+	if resp != nil && resp.response != nil {
+		switch resp.StatusCode() {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			if retryAfter := parseRetryAfter(resp.Headers().Get("Retry-After")); retryAfter > 0 {
+				if retryAfter > obj.option.Max {
+					retryAfter = obj.option.Max
+				}
+				return retryAfter, true
+			}
+		}
+	}
+	delay := obj.option.Base << (tryNum - 1)
+	if delay > obj.option.Max || delay <= 0 {
+		delay = obj.option.Max
+	}
+	if !obj.option.DisJitter { //full jitter
+		delay = time.Duration(rand.Int63n(int64(delay)) + 1)
+	}
+	return delay, true
+}
+
+func retryWait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
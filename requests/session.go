@@ -0,0 +1,117 @@
+package requests
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/justseemore/gospider/tools"
+	utls "github.com/refraction-networking/utls"
+)
+
+// 序列化后的tls session
+type sessionData struct {
+	Ticket []byte `json:"ticket"`
+	State  []byte `json:"state"`
+}
+
+// 持久化的tls session 缓存,key 为代理和server name,实现utls.ClientSessionCache
+type utlsSessionCache struct {
+	store CacheStore
+	proxy string
+}
+
+// session 保存的时间,tls1.3 中ticket 的有效期最长为7天
+const sessionTTL = time.Hour * 24 * 7
+
+func sessionKey(proxy string, sessionKey string) string {
+	return "tls-session:" + proxy + "@" + sessionKey
+}
+func newUtlsSessionCache(store CacheStore, proxy string) *utlsSessionCache {
+	return &utlsSessionCache{store: store, proxy: proxy}
+}
+func (obj *utlsSessionCache) Get(key string) (*utls.ClientSessionState, bool) {
+	con, ok := obj.store.Get(sessionKey(obj.proxy, key))
+	if !ok {
+		return nil, false
+	}
+	var data sessionData
+	if err := tools.JsonUnMarshal(con, &data); err != nil {
+		return nil, false
+	}
+	state, err := utls.ParseSessionState(data.State)
+	if err != nil {
+		return nil, false
+	}
+	session, err := utls.NewResumptionState(data.Ticket, state)
+	if err != nil {
+		return nil, false
+	}
+	return session, true
+}
+func (obj *utlsSessionCache) Put(key string, session *utls.ClientSessionState) {
+	if session == nil {
+		obj.store.Del(sessionKey(obj.proxy, key))
+		return
+	}
+	ticket, state, err := session.ResumptionState()
+	if err != nil || state == nil {
+		return
+	}
+	stateCon, err := state.Bytes()
+	if err != nil {
+		return
+	}
+	con, err := tools.JsonMarshal(sessionData{Ticket: ticket, State: stateCon})
+	if err != nil {
+		return
+	}
+	obj.store.Set(sessionKey(obj.proxy, key), con, sessionTTL)
+}
+
+// 持久化的tls session 缓存,实现tls.ClientSessionCache
+type tlsSessionCache struct {
+	store CacheStore
+	proxy string
+}
+
+func newTlsSessionCache(store CacheStore, proxy string) *tlsSessionCache {
+	return &tlsSessionCache{store: store, proxy: proxy}
+}
+func (obj *tlsSessionCache) Get(key string) (*tls.ClientSessionState, bool) {
+	con, ok := obj.store.Get(sessionKey(obj.proxy, key))
+	if !ok {
+		return nil, false
+	}
+	var data sessionData
+	if err := tools.JsonUnMarshal(con, &data); err != nil {
+		return nil, false
+	}
+	state, err := tls.ParseSessionState(data.State)
+	if err != nil {
+		return nil, false
+	}
+	session, err := tls.NewResumptionState(data.Ticket, state)
+	if err != nil {
+		return nil, false
+	}
+	return session, true
+}
+func (obj *tlsSessionCache) Put(key string, session *tls.ClientSessionState) {
+	if session == nil {
+		obj.store.Del(sessionKey(obj.proxy, key))
+		return
+	}
+	ticket, state, err := session.ResumptionState()
+	if err != nil || state == nil {
+		return
+	}
+	stateCon, err := state.Bytes()
+	if err != nil {
+		return
+	}
+	con, err := tools.JsonMarshal(sessionData{Ticket: ticket, State: stateCon})
+	if err != nil {
+		return
+	}
+	obj.store.Set(sessionKey(obj.proxy, key), con, sessionTTL)
+}
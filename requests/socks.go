@@ -0,0 +1,131 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/justseemore/gospider/tools"
+)
+
+// 代理握手失败的错误,可以在ErrCallBack 中使用errors.As 获取,用于区分代理认证失败和目标拒绝连接
+type ProxyError struct {
+	Proxy      string      //代理,不包含密码
+	StatusCode int         //http 代理为CONNECT 响应的状态码,socks 代理为回复码
+	Status     string      //状态描述
+	Header     http.Header //http 代理CONNECT 响应的headers,socks 代理为nil
+	AuthFailed bool        //是否为代理认证失败
+}
+
+func (obj *ProxyError) Error() string {
+	return "代理连接失败: " + obj.Proxy + ", " + obj.Status
+}
+func newSocksProxyError(proxyUrl *url.URL, statusCode int, status string, authFailed bool) *ProxyError {
+	return &ProxyError{
+		Proxy:      proxyUrl.Redacted(),
+		StatusCode: statusCode,
+		Status:     strconv.Itoa(statusCode) + " " + status,
+		AuthFailed: authFailed,
+	}
+}
+
+// socks5 连接的回复码
+func socks5Status(code byte) string {
+	switch code {
+	case 1:
+		return "代理服务器错误"
+	case 2:
+		return "规则不允许连接"
+	case 3:
+		return "网络不可达"
+	case 4:
+		return "主机不可达"
+	case 5:
+		return "目标拒绝连接"
+	case 6:
+		return "ttl 过期"
+	case 7:
+		return "不支持的命令"
+	case 8:
+		return "不支持的地址类型"
+	default:
+		return "连接失败"
+	}
+}
+
+func (obj *DialClient) socks4Handshake(ctx context.Context, proxyUrl *url.URL, addr string, conn net.Conn) (err error) {
+	didVerify := make(chan struct{})
+	go func() {
+		defer close(didVerify)
+		err = obj.clientVerifySocks4(ctx, proxyUrl, addr, conn)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-didVerify:
+		return
+	}
+}
+
+// socks4 在本地解析域名,只支持ipv4,socks4a 由代理解析域名
+func (obj *DialClient) clientVerifySocks4(ctx context.Context, proxyUrl *url.URL, addr string, conn net.Conn) (err error) {
+	host, port, err := tools.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var ip net.IP
+	var domain string
+	if hostIp, ipInt := tools.ParseHost(host); ipInt == 4 {
+		ip = hostIp
+	} else if ipInt == 6 {
+		return errors.New(proxyUrl.Scheme + " 不支持ipv6: " + host)
+	} else if proxyUrl.Scheme == "socks4a" {
+		//ip 为0.0.0.x 时,域名在用户名之后
+		ip, domain = net.IPv4(0, 0, 0, 1), host
+	} else {
+		addrs, err := obj.AddrToIps(ctx, addr)
+		if err != nil {
+			return err
+		}
+		for _, ipAddr := range addrs {
+			ipHost, _, _ := net.SplitHostPort(ipAddr)
+			if ip = net.ParseIP(ipHost).To4(); ip != nil {
+				break
+			}
+		}
+		if ip == nil {
+			return errors.New("socks4 没有解析到ipv4: " + host)
+		}
+	}
+	writeCon := []byte{4, 1, byte(port >> 8), byte(port)}
+	writeCon = append(writeCon, ip.To4()...)
+	if proxyUrl.User != nil {
+		writeCon = append(writeCon, proxyUrl.User.Username()...)
+	}
+	writeCon = append(writeCon, 0)
+	if domain != "" {
+		writeCon = append(writeCon, domain...)
+		writeCon = append(writeCon, 0)
+	}
+	if _, err = conn.Write(writeCon); err != nil {
+		return
+	}
+	readCon := make([]byte, 8)
+	if _, err = io.ReadFull(conn, readCon); err != nil {
+		return
+	}
+	switch readCon[1] {
+	case 0x5a:
+		return nil
+	case 0x5c:
+		return newSocksProxyError(proxyUrl, 0x5c, "无法连接客户端的identd", true)
+	case 0x5d:
+		return newSocksProxyError(proxyUrl, 0x5d, "identd 验证用户失败", true)
+	default:
+		return newSocksProxyError(proxyUrl, int(readCon[1]), "请求被拒绝或失败", false)
+	}
+}
@@ -0,0 +1,148 @@
+package requests
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// 请求的耗时和连接信息
+type TraceInfo struct {
+	Proxy        string        //使用的代理,不包含密码
+	LocalAddr    string        //本地地址
+	RemoteAddr   string        //远程地址,使用代理时为代理的地址
+	Reused       bool          //是否复用了连接
+	Proto        string        //http 协议
+	TlsVersion   string        //tls 版本
+	Alpn         string        //tls 协商的协议
+	CipherSuite  string        //tls 加密套件
+	Resumed      bool          //tls 会话是否复用
+	Dns          time.Duration //dns 解析时间,包括代理的dns 解析
+	Connect      time.Duration //tcp 连接时间,使用代理时为连接代理的时间
+	ProxyConnect time.Duration //代理握手时间,http connect 或者socks5
+	Tls          time.Duration //tls 握手时间
+	Ttfb         time.Duration //请求发送完成到收到第一个字节的时间
+	Body         time.Duration //读取body 的时间,DisRead 时为0
+	Total        time.Duration //发送请求到收到response headers 的总时间
+	StartTime    time.Time     //开始请求的时间
+}
+
+// 新建连接时记录的信息,复用连接时也可以获取
+type connTrace struct {
+	proxy        string
+	localAddr    string
+	remoteAddr   string
+	tlsVersion   string
+	alpn         string
+	cipherSuite  string
+	resumed      bool
+	dns          time.Duration
+	connect      time.Duration
+	proxyConnect time.Duration
+	tls          time.Duration
+}
+
+func (obj *connTrace) setTls(version uint16, alpn string, cipherSuite uint16, resumed bool) {
+	obj.tlsVersion = tls.VersionName(version)
+	obj.alpn = alpn
+	obj.cipherSuite = tls.CipherSuiteName(cipherSuite)
+	obj.resumed = resumed
+}
+
+type connTraceKey string
+
+const (
+	keyConnTrace connTraceKey = "gospiderConnTrace"
+	keyTlsTrace  connTraceKey = "gospiderTlsTrace"
+)
+
+func getConnTrace(ctx context.Context, key connTraceKey) *connTrace {
+	trace, _ := ctx.Value(key).(*connTrace)
+	return trace
+}
+
+// 带有连接信息的连接,关闭时删除记录
+type traceConn struct {
+	net.Conn
+	trace   *connTrace
+	once    sync.Once
+	onClose func()
+}
+
+func (obj *traceConn) Close() error {
+	if obj.onClose != nil {
+		obj.once.Do(obj.onClose)
+	}
+	return obj.Conn.Close()
+}
+
+// 记录tls 连接的信息,tls 连接关闭时删除
+func (obj *DialClient) storeConnTrace(conn net.Conn, rawConn *traceConn) {
+	obj.connTraces.Store(conn, rawConn.trace)
+	rawConn.onClose = func() {
+		obj.connTraces.Delete(conn)
+	}
+}
+func (obj *DialClient) loadConnTrace(conn net.Conn) *connTrace {
+	switch orderConn := conn.(type) {
+	case *orderConn:
+		conn = orderConn.Conn
+	case *orderTlsConn:
+		conn = orderConn.Conn
+	}
+	if rawConn, ok := conn.(*traceConn); ok {
+		return rawConn.trace
+	}
+	if trace, ok := obj.connTraces.Load(conn); ok {
+		return trace.(*connTrace)
+	}
+	return nil
+}
+
+// 通过httptrace 记录连接和首字节时间
+func (obj *reqCtxData) clientTrace(dialer *DialClient) *httptrace.ClientTrace {
+	var wroteTime time.Time
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace := obj.trace
+			*trace = TraceInfo{StartTime: trace.StartTime, Reused: info.Reused}
+			if info.Conn == nil {
+				return
+			}
+			switch conn := info.Conn.(type) { //设置http1.1 请求头的顺序
+			case *orderConn:
+				conn.setOrder(obj.orderHeaders)
+			case *orderTlsConn:
+				conn.setOrder(obj.orderHeaders)
+			}
+			trace.LocalAddr = info.Conn.LocalAddr().String()
+			trace.RemoteAddr = info.Conn.RemoteAddr().String()
+			if connTrace := dialer.loadConnTrace(info.Conn); connTrace != nil {
+				trace.Proxy = connTrace.proxy
+				trace.LocalAddr = connTrace.localAddr
+				trace.RemoteAddr = connTrace.remoteAddr
+				trace.TlsVersion = connTrace.tlsVersion
+				trace.Alpn = connTrace.alpn
+				trace.CipherSuite = connTrace.cipherSuite
+				trace.Resumed = connTrace.resumed
+				if !info.Reused {
+					trace.Dns = connTrace.dns
+					trace.Connect = connTrace.connect
+					trace.ProxyConnect = connTrace.proxyConnect
+					trace.Tls = connTrace.tls
+				}
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			wroteTime = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			if !wroteTime.IsZero() {
+				obj.trace.Ttfb = time.Since(wroteTime)
+			}
+		},
+	}
+}
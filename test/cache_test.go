@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+// 第二次请求的缓存状态,覆盖新鲜度,age 的计算和是否可以存储
+func TestCacheFreshness(t *testing.T) {
+	now := time.Now()
+	httpTime := func(d time.Duration) string {
+		return now.Add(d).UTC().Format(http.TimeFormat)
+	}
+	tests := []struct {
+		name       string
+		header     map[string]string //响应的headers
+		reqHeader  map[string]string //请求的headers
+		status     requests.CacheStatus
+		minAge     int //缓存响应中Age 的最小值
+		serverHits int //服务器收到的请求次数
+	}{
+		{name: "max-age", header: map[string]string{"Cache-Control": "max-age=60"}, status: requests.CacheHit, serverHits: 1},
+		{name: "max-age 0", header: map[string]string{"Cache-Control": "max-age=0"}, status: requests.CacheMiss, serverHits: 2},
+		{name: "no-store", header: map[string]string{"Cache-Control": "no-store, max-age=60"}, status: requests.CacheMiss, serverHits: 2},
+		{name: "no-cache etag", header: map[string]string{"Cache-Control": "no-cache", "ETag": `"v1"`}, status: requests.CacheRevalidated, serverHits: 2},
+		{name: "age header", header: map[string]string{"Cache-Control": "max-age=60", "Age": "100"}, status: requests.CacheMiss, serverHits: 2},
+		{name: "age in lifetime", header: map[string]string{"Cache-Control": "max-age=60", "Age": "30"}, status: requests.CacheHit, minAge: 30, serverHits: 1},
+		{name: "apparent age", header: map[string]string{"Cache-Control": "max-age=5", "Date": httpTime(-time.Second * 10)}, status: requests.CacheMiss, serverHits: 2},
+		{name: "expires", header: map[string]string{"Expires": httpTime(time.Hour)}, status: requests.CacheHit, serverHits: 1},
+		{name: "expired last-modified", header: map[string]string{"Expires": httpTime(-time.Hour), "Last-Modified": httpTime(-time.Hour * 2)}, status: requests.CacheRevalidated, serverHits: 2},
+		{name: "heuristic", header: map[string]string{"Last-Modified": httpTime(-time.Hour * 24 * 10)}, status: requests.CacheHit, serverHits: 1},
+		{name: "no validator", header: map[string]string{}, status: requests.CacheMiss, serverHits: 2},
+		{name: "vary star", header: map[string]string{"Cache-Control": "max-age=60", "Vary": "*"}, status: requests.CacheMiss, serverHits: 2},
+		{name: "authorization", header: map[string]string{"Cache-Control": "max-age=60"}, reqHeader: map[string]string{"Authorization": "Bearer a"}, status: requests.CacheMiss, serverHits: 2},
+		{name: "authorization public", header: map[string]string{"Cache-Control": "public, max-age=60"}, reqHeader: map[string]string{"Authorization": "Bearer a"}, status: requests.CacheHit, serverHits: 1},
+		{name: "request no-cache", header: map[string]string{"Cache-Control": "max-age=60", "ETag": `"v1"`}, reqHeader: map[string]string{"Cache-Control": "no-cache"}, status: requests.CacheRevalidated, serverHits: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var serverHits int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHits++
+				for key, val := range test.header {
+					w.Header().Set(key, val)
+				}
+				etag, lastModified := test.header["ETag"], test.header["Last-Modified"]
+				if (etag != "" && r.Header.Get("If-None-Match") == etag) || (lastModified != "" && r.Header.Get("If-Modified-Since") == lastModified) {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Write([]byte("hello"))
+			}))
+			defer server.Close()
+			reqCli, err := requests.NewClient(nil, requests.ClientOption{Cache: requests.NewMemoryCacheStore(0)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var option requests.RequestOption
+			if test.reqHeader != nil {
+				option.Headers = test.reqHeader
+			}
+			var resp *requests.Response
+			for i := 0; i < 2; i++ {
+				if resp, err = reqCli.Request(nil, "get", server.URL, option); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Text() != "hello" {
+					t.Fatal("响应内容错误: ", resp.Text())
+				}
+			}
+			var status requests.CacheStatus
+			if resp.FromCache() {
+				status = requests.CacheHit
+			} else if resp.Revalidated() {
+				status = requests.CacheRevalidated
+			}
+			if status != test.status || serverHits != test.serverHits {
+				t.Fatal("缓存状态错误: ", status, serverHits)
+			}
+			if status != requests.CacheMiss {
+				if age, err := strconv.Atoi(resp.Headers().Get("Age")); err != nil || age < test.minAge {
+					t.Fatal("Age 错误: ", resp.Headers().Get("Age"))
+				}
+			}
+		})
+	}
+}
+
+// Vary 不同的变体同时缓存,不会互相覆盖
+func TestCacheVary(t *testing.T) {
+	var serverHits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHits++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+	reqCli, err := requests.NewClient(nil, requests.ClientOption{Cache: requests.NewMemoryCacheStore(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		for _, lang := range []string{"en", "zh"} {
+			resp, err := reqCli.Request(nil, "get", server.URL, requests.RequestOption{Headers: map[string]string{"Accept-Language": lang}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Text() != lang || resp.FromCache() != (i > 0) {
+				t.Fatal("变体缓存错误: ", lang, resp.Text(), resp.FromCache())
+			}
+		}
+	}
+	if serverHits != 2 {
+		t.Fatal("服务器收到的请求次数错误: ", serverHits)
+	}
+}
+
+func TestCacheStore(t *testing.T) {
+	dirStore, err := requests.NewDirCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		store requests.CacheStore
+		lru   bool //最多保存2个
+	}{
+		{name: "memory", store: requests.NewMemoryCacheStore(2), lru: true},
+		{name: "dir", store: dirStore},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := test.store
+			if err := store.Set("a", []byte("1"), 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Set("b", []byte("2"), time.Millisecond*20); err != nil {
+				t.Fatal(err)
+			}
+			if val, ok := store.Get("a"); !ok || string(val) != "1" {
+				t.Fatal("获取缓存错误: ", string(val), ok)
+			}
+			if val, ok := store.Get("b"); !ok || string(val) != "2" {
+				t.Fatal("获取缓存错误: ", string(val), ok)
+			}
+			time.Sleep(time.Millisecond * 30)
+			if _, ok := store.Get("b"); ok {
+				t.Fatal("过期的缓存没有删除")
+			}
+			store.Set("c", []byte("3"), 0)
+			store.Get("a")
+			store.Set("d", []byte("4"), 0)
+			_, ok := store.Get("c")
+			if test.lru == ok {
+				t.Fatal("超过数量时没有删除最久没有使用的缓存")
+			}
+			if _, ok = store.Get("a"); !ok {
+				t.Fatal("最近使用的缓存被删除")
+			}
+			store.Del("a")
+			if _, ok = store.Get("a"); ok {
+				t.Fatal("删除缓存失败")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+func TestParseCurl(t *testing.T) {
+	cmd := `curl 'https://example.com/api?page=1' \
+  -H 'accept: application/json' \
+  -H $'x-token: a\'b' \
+  -b 'sid=123; lang=zh' \
+  -H 'content-type: application/json' \
+  --data-raw '{"name":"gospider"}' \
+  --compressed`
+	method, href, option, err := requests.ParseCurl(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "POST" || href != "https://example.com/api?page=1" {
+		t.Fatal("method 或url 错误: ", method, href)
+	}
+	headers := option.Headers.(http.Header)
+	if headers.Get("X-Token") != "a'b" || headers.Get("Content-Type") != "application/json" || headers.Get("Accept-Encoding") == "" {
+		t.Fatal("headers 错误: ", headers)
+	}
+	if option.Cookies != "sid=123; lang=zh" || option.Data != `{"name":"gospider"}` {
+		t.Fatal("cookies 或data 错误: ", option.Cookies, option.Data)
+	}
+	curl, err := option.Curl(method, href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	method2, href2, option2, err := requests.ParseCurl(curl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method2 != method || href2 != href || option2.Data != option.Data || option2.Cookies != option.Cookies {
+		t.Fatal("curl 转换错误: ", curl)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+// 写入指定大小后断开连接
+type abortWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (obj *abortWriter) Write(con []byte) (int, error) {
+	if obj.limit <= 0 {
+		return obj.ResponseWriter.Write(con)
+	}
+	if len(con) >= obj.limit {
+		obj.ResponseWriter.Write(con[:obj.limit])
+		obj.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	obj.limit -= len(con)
+	return obj.ResponseWriter.Write(con)
+}
+
+type downloadServer struct {
+	content     []byte
+	etag        string
+	ignoreRange bool //支持Range,但是返回完整的文件
+	abortAfter  int  //下一个请求写入的大小,之后断开连接
+	headers     []http.Header
+	lock        sync.Mutex
+}
+
+func (obj *downloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	obj.lock.Lock()
+	obj.headers = append(obj.headers, r.Header.Clone())
+	content, etag, ignoreRange, abortAfter := obj.content, obj.etag, obj.ignoreRange, obj.abortAfter
+	obj.abortAfter = 0
+	obj.lock.Unlock()
+	writer := &abortWriter{ResponseWriter: w, limit: abortAfter}
+	w.Header().Set("ETag", etag)
+	if ignoreRange {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		writer.Write(content)
+		return
+	}
+	http.ServeContent(writer, r, "", time.Time{}, bytes.NewReader(content))
+}
+func (obj *downloadServer) set(fun func()) {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	fun()
+}
+
+// 返回Range 请求的headers
+func (obj *downloadServer) rangeHeaders() []http.Header {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	var headers []http.Header
+	for _, header := range obj.headers {
+		if header.Get("Range") != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+func downloadContent(size int, seed byte) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i*7) + seed
+	}
+	return content
+}
+
+func TestDownload(t *testing.T) {
+	reqCli, err := requests.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newServer := func(content []byte) (*downloadServer, *httptest.Server) {
+		down := &downloadServer{content: content, etag: `"v1"`}
+		return down, httptest.NewServer(down)
+	}
+	checkFile := func(t *testing.T, path string, content []byte) {
+		con, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(con, content) {
+			t.Fatal("下载的文件内容错误: ", len(con))
+		}
+		if _, err = os.Stat(path + ".part.json"); err == nil {
+			t.Fatal("下载完成后没有删除进度文件")
+		}
+	}
+	t.Run("segments", func(t *testing.T) {
+		content := downloadContent(3*1024*1024, 1)
+		down, server := newServer(content)
+		defer server.Close()
+		path := t.TempDir() + "/file"
+		if err := reqCli.Download(nil, server.URL, path, requests.DownloadOption{Segments: 3}); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, path, content)
+		headers := down.rangeHeaders()
+		if len(headers) != 2 {
+			t.Fatal("分段的数量错误: ", len(headers))
+		}
+		for _, header := range headers {
+			if header.Get("If-Range") != `"v1"` {
+				t.Fatal("分段请求没有If-Range: ", header)
+			}
+		}
+	})
+	t.Run("resume", func(t *testing.T) {
+		content := downloadContent(100*1024, 2)
+		down, server := newServer(content)
+		defer server.Close()
+		path := t.TempDir() + "/file"
+		down.set(func() { down.abortAfter = 40 * 1024 })
+		if err := reqCli.Download(nil, server.URL, path); err == nil {
+			t.Fatal("连接断开时没有返回错误")
+		}
+		if _, err := os.Stat(path + ".part.json"); err != nil {
+			t.Fatal("没有保存下载进度: ", err)
+		}
+		if err := reqCli.Download(nil, server.URL, path); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, path, content)
+		headers := down.rangeHeaders()
+		if len(headers) != 1 || headers[0].Get("Range") != "bytes=40960-102399" || headers[0].Get("If-Range") != `"v1"` {
+			t.Fatal("断点续传的请求错误: ", headers)
+		}
+	})
+	t.Run("retry", func(t *testing.T) {
+		content := downloadContent(100*1024, 3)
+		down, server := newServer(content)
+		defer server.Close()
+		path := t.TempDir() + "/file"
+		down.set(func() { down.abortAfter = 40 * 1024 })
+		if err := reqCli.Download(nil, server.URL, path, requests.DownloadOption{RequestOption: requests.RequestOption{TryNum: 1}}); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, path, content)
+		if headers := down.rangeHeaders(); len(headers) != 1 || headers[0].Get("Range") != "bytes=40960-102399" {
+			t.Fatal("读取失败后没有从断点继续: ", headers)
+		}
+	})
+	t.Run("ignore range", func(t *testing.T) {
+		content := downloadContent(100*1024, 4)
+		down, server := newServer(content)
+		defer server.Close()
+		path := t.TempDir() + "/file"
+		down.set(func() {
+			down.ignoreRange = true
+			down.abortAfter = 40 * 1024
+		})
+		if err := reqCli.Download(nil, server.URL, path, requests.DownloadOption{RequestOption: requests.RequestOption{TryNum: 1, Bar: true}}); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, path, content)
+	})
+	t.Run("etag change", func(t *testing.T) {
+		content := downloadContent(2*1024*1024, 5)
+		down, server := newServer(content)
+		defer server.Close()
+		path := t.TempDir() + "/file"
+		down.set(func() { down.abortAfter = 100 * 1024 })
+		if err := reqCli.Download(nil, server.URL, path, requests.DownloadOption{Segments: 2}); err == nil {
+			t.Fatal("连接断开时没有返回错误")
+		}
+		newContent := downloadContent(2*1024*1024, 6)
+		down.set(func() {
+			down.content = newContent
+			down.etag = `"v2"`
+		})
+		if err := reqCli.Download(nil, server.URL, path, requests.DownloadOption{Segments: 2}); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, path, newContent)
+	})
+	t.Run("checksum", func(t *testing.T) {
+		content := downloadContent(10*1024, 7)
+		_, server := newServer(content)
+		defer server.Close()
+		sum := sha256.Sum256(content)
+		tests := []struct {
+			checksum string
+			ok       bool
+		}{
+			{checksum: "sha256:" + hex.EncodeToString(sum[:]), ok: true},
+			{checksum: "sha256:" + hex.EncodeToString(make([]byte, 32))},
+			{checksum: "crc32:00000000"},
+		}
+		for _, test := range tests {
+			path := t.TempDir() + "/file"
+			err := reqCli.Download(nil, server.URL, path, requests.DownloadOption{Checksum: test.checksum})
+			if test.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkFile(t, path, content)
+				continue
+			}
+			if err == nil {
+				t.Fatal("checksum 错误时没有返回错误: ", test.checksum)
+			}
+			for _, name := range []string{path, path + ".part", path + ".part.json"} {
+				if _, err = os.Stat(name); err == nil {
+					t.Fatal("checksum 错误时没有删除文件: ", name)
+				}
+			}
+		}
+	})
+}
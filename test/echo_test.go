@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/justseemore/gospider/echo"
+	"github.com/justseemore/gospider/ja3"
+	"github.com/justseemore/gospider/requests"
+)
+
+func TestEchoProfile(t *testing.T) {
+	server, err := echo.NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	reqCli, err := requests.NewClient(nil, requests.ClientOption{Ja3: true, H2Ja3: true, Profile: requests.ProfileChrome114})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := reqCli.Request(nil, "get", server.Url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result echo.Response
+	if _, err = resp.Json(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Tls.Alpn != "h2" || result.H2 == nil {
+		t.Fatal("没有使用http2: ", result.Proto)
+	}
+	spec, err := ja3.CreateSpecWithId(ja3.HelloChrome_114_Padding_PSK_Shuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Split(result.Tls.Ja3, ",")[1] != strings.Split(spec.String(), ",")[1] {
+		t.Fatal("ja3 密码套件错误: ", result.Tls.Ja3)
+	}
+	if result.H2.Akamai != "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p" {
+		t.Fatal("h2 指纹错误: ", result.H2.Akamai)
+	}
+	var names []string
+	for _, header := range result.Headers {
+		names = append(names, header[0])
+	}
+	if strings.Join(names[:5], ",") != ":method,:authority,:scheme,:path,sec-ch-ua" {
+		t.Fatal("请求头顺序错误: ", names)
+	}
+}
+
+func TestEchoHttp1Headers(t *testing.T) {
+	server, err := echo.NewServer(nil, echo.ServerOption{DisHttp2: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	reqCli, err := requests.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := reqCli.Request(nil, "post", server.Url(), requests.RequestOption{
+			Headers: requests.OrderHeaders{
+				{"x-b", "1"},
+				{"Host", ""},
+				{"X-A", "2"},
+			},
+			Data: "a=1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result echo.Response
+		if _, err = resp.Json(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Proto != "HTTP/1.1" || result.Body != "a=1" {
+			t.Fatal("请求错误: ", result.Proto, result.Body)
+		}
+		if len(result.Headers) < 3 || result.Headers[0][0] != "x-b" || result.Headers[1][0] != "Host" || result.Headers[2][0] != "X-A" {
+			t.Fatal("请求头顺序错误: ", result.Headers)
+		}
+	}
+}
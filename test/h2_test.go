@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/justseemore/gospider/ja3"
+	"github.com/justseemore/gospider/tools"
+)
+
+func TestH2Fingerprint(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		fp   ja3.H2Fingerprint
+	}{
+		{
+			name: "chrome",
+			str:  "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p",
+			fp: ja3.H2Fingerprint{
+				Settings:     []ja3.Setting{{Id: 1, Val: 65536}, {Id: 2, Val: 0}, {Id: 4, Val: 6291456}, {Id: 6, Val: 262144}},
+				ConnFlow:     15663105,
+				OrderHeaders: []string{":method", ":authority", ":scheme", ":path"},
+			},
+		},
+		{
+			name: "firefox",
+			str:  "1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s",
+			fp: ja3.H2Fingerprint{
+				Settings: []ja3.Setting{{Id: 1, Val: 65536}, {Id: 4, Val: 131072}, {Id: 5, Val: 16384}},
+				ConnFlow: 12517377,
+				PriorityFrames: []ja3.H2PriorityFrame{
+					{StreamId: 3, Priority: ja3.Priority{StreamDep: 0, Weight: 200}},
+					{StreamId: 5, Priority: ja3.Priority{StreamDep: 0, Weight: 100}},
+					{StreamId: 7, Priority: ja3.Priority{StreamDep: 0, Weight: 0}},
+					{StreamId: 9, Priority: ja3.Priority{StreamDep: 7, Weight: 0}},
+					{StreamId: 11, Priority: ja3.Priority{StreamDep: 3, Weight: 0}},
+					{StreamId: 13, Priority: ja3.Priority{StreamDep: 0, Weight: 240}},
+				},
+				OrderHeaders: []string{":method", ":path", ":authority", ":scheme"},
+			},
+		},
+		{
+			name: "exclusive",
+			str:  "4:4194304;3:100|10485760|1:1:0:256|m,s,p,a",
+			fp: ja3.H2Fingerprint{
+				Settings:       []ja3.Setting{{Id: 4, Val: 4194304}, {Id: 3, Val: 100}},
+				ConnFlow:       10485760,
+				PriorityFrames: []ja3.H2PriorityFrame{{StreamId: 1, Priority: ja3.Priority{Exclusive: true, StreamDep: 0, Weight: 255}}},
+				OrderHeaders:   []string{":method", ":scheme", ":path", ":authority"},
+			},
+		},
+		{
+			name: "no settings",
+			str:  "|0|0|m,a,s,p",
+			fp: ja3.H2Fingerprint{
+				OrderHeaders: []string{":method", ":authority", ":scheme", ":path"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fp, err := ja3.ParseH2Fingerprint(test.str)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fp, test.fp) {
+				t.Fatalf("解析错误:\n%+v\n%+v", fp, test.fp)
+			}
+			if fp.String() != test.str {
+				t.Fatal("转换为字符串错误: ", fp.String())
+			}
+			if test.fp.String() != test.str {
+				t.Fatal("转换为字符串错误: ", test.fp.String())
+			}
+			if fp.Hash() != tools.Hex(tools.Md5(test.str)) {
+				t.Fatal("hash 错误: ", fp.Hash())
+			}
+			spec, err := ja3.CreateH2SpecWithStr(test.str)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(spec.InitialSetting, test.fp.Settings) || spec.ConnFlow != test.fp.ConnFlow || !reflect.DeepEqual(spec.OrderHeaders, test.fp.OrderHeaders) {
+				t.Fatalf("h2 指纹错误: %+v", spec)
+			}
+		})
+	}
+	for _, str := range []string{
+		"",
+		"1:65536|15663105|0",
+		"1:65536:1|15663105|0|m,a,s,p",
+		"1:a|15663105|0|m,a,s,p",
+		"1:65536|-1|0|m,a,s,p",
+		"1:65536|15663105|3:0:0|m,a,s,p",
+		"1:65536|15663105|3:0:0:0|m,a,s,p",
+		"1:65536|15663105|3:0:0:257|m,a,s,p",
+		"1:65536|15663105|0|m,a,x",
+	} {
+		if _, err := ja3.ParseH2Fingerprint(str); err == nil {
+			t.Fatal("错误的h2 指纹没有返回错误: ", str)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+func gzipBytes(con []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(buf)
+	writer.Write(con)
+	writer.Close()
+	return buf.Bytes()
+}
+
+// 记录的是解压后的内容,回放时与真实请求的结果一致
+func TestHarRecordReplay(t *testing.T) {
+	text := strings.Repeat(`{"name":"gospider"}`, 100)
+	binary := []byte{0xff, 0xfe, 0x00, 0x01}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBytes([]byte(text)))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(binary)
+		default:
+			http.Redirect(w, r, "/gzip", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	recorder := requests.NewHarRecorder()
+	reqCli, err := requests.NewClient(nil, requests.ClientOption{HarRecorder: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/redirect", "/binary"} {
+		if _, err = reqCli.Request(nil, "get", server.URL+path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := t.TempDir() + "/test.har"
+	if err = recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	har, err := requests.LoadHar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 3 {
+		t.Fatal("har 记录的数量错误: ", len(har.Log.Entries))
+	}
+	gzipResp := har.Log.Entries[1].Response
+	if gzipResp.Content.Text != text || gzipResp.Content.Encoding != "" || gzipResp.Content.Size != int64(len(text)) {
+		t.Fatal("har 没有记录解压后的内容: ", gzipResp.Content.Size, gzipResp.Content.Encoding)
+	}
+	if wireSize := int64(len(gzipBytes([]byte(text)))); gzipResp.BodySize != wireSize || gzipResp.Content.Compression != int64(len(text))-wireSize {
+		t.Fatal("bodySize 错误: ", gzipResp.BodySize, gzipResp.Content.Compression)
+	}
+	if binaryResp := har.Log.Entries[2].Response; binaryResp.Content.Encoding != "base64" || binaryResp.Content.Text != base64.StdEncoding.EncodeToString(binary) {
+		t.Fatal("二进制内容记录错误: ", binaryResp.Content.Text)
+	}
+	replayCli, err := requests.NewClient(nil, requests.ClientOption{HarReplay: har})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path    string
+		content []byte
+	}{
+		{path: "/redirect", content: []byte(text)},
+		{path: "/gzip", content: []byte(text)},
+		{path: "/binary", content: binary},
+	}
+	for _, test := range tests {
+		resp, err := replayCli.Request(nil, "get", server.URL+test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(resp.Content(), test.content) {
+			t.Fatal("回放的内容错误: ", test.path, resp.Text())
+		}
+	}
+	if _, err = replayCli.Request(nil, "get", server.URL+"/none"); err == nil {
+		t.Fatal("har 中没有的请求没有返回错误")
+	}
+}
+
+// 浏览器导出的har,headers 中有原始的Content-Encoding 和Content-Length
+func TestHarReplayBrowser(t *testing.T) {
+	text := `{"browser":"chrome"}`
+	har := &requests.Har{Log: requests.HarLog{Version: "1.2", Entries: []requests.HarEntry{{
+		Request: requests.HarRequest{Method: "GET", Url: "https://example.com/api", HttpVersion: "http/2.0"},
+		Response: requests.HarResponse{
+			Status:      200,
+			HttpVersion: "http/2.0",
+			Headers: []requests.HarNameValue{
+				{Name: "content-type", Value: "application/json"},
+				{Name: "content-encoding", Value: "br"},
+				{Name: "content-length", Value: "12"},
+			},
+			Content:  requests.HarContent{Size: int64(len(text)), MimeType: "application/json", Text: text},
+			BodySize: 12,
+		},
+	}}}}
+	reqCli, err := requests.NewClient(nil, requests.ClientOption{HarReplay: har})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := reqCli.Request(nil, "get", "https://example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonData, err := resp.Json(); err != nil || jsonData.Get("browser").String() != "chrome" {
+		t.Fatal("回放的内容错误: ", resp.Text())
+	}
+	if resp.Headers().Get("Content-Type") != "application/json" || resp.ContentEncoding() != "" {
+		t.Fatal("回放的headers 错误: ", resp.Headers())
+	}
+}
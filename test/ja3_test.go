@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/justseemore/gospider/ja3"
+	utls "github.com/refraction-networking/utls"
+)
+
+var ja3Ids = []struct {
+	name string
+	id   ja3.ClientHelloId
+}{
+	{"chrome106", ja3.HelloChrome_106_Shuffle},
+	{"chrome114", ja3.HelloChrome_114_Padding_PSK_Shuf},
+	{"firefox105", ja3.HelloFirefox_105},
+	{"edge106", ja3.HelloEdge_106},
+	{"safari16", ja3.HelloSafari_16_0},
+}
+
+func TestJa3SpecJson(t *testing.T) {
+	for _, test := range ja3Ids {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := ja3.CreateSpecWithId(test.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			con, err := json.Marshal(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var spec2 ja3.Ja3Spec
+			if err = json.Unmarshal(con, &spec2); err != nil {
+				t.Fatal(err)
+			}
+			if spec2.String() != spec.String() || spec2.Hash() != spec.Hash() {
+				t.Fatal("json 还原后ja3 不一致: ", spec.String(), spec2.String())
+			}
+			con2, err := json.Marshal(spec2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(con) != string(con2) {
+				t.Fatal("json 还原后不一致: ", string(con), string(con2))
+			}
+		})
+	}
+	if err := json.Unmarshal([]byte(`{"extensions":[]}`), new(ja3.Ja3Spec)); err == nil {
+		t.Fatal("没有cipherSuites 的json 没有返回错误")
+	}
+}
+
+func TestJa3SpecString(t *testing.T) {
+	tests := []string{
+		"771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513,29-23-24,0",
+		"771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-34-51-43-13-45-28-21,29-23-24-25-256-257,0",
+		"771,4866-4867-4865-255,0-11-10-35-22-23-13-43-45-51,29-23-30-25-24,0-1-2",
+	}
+	for _, test := range tests {
+		spec, err := ja3.CreateSpecWithStr(test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.String() != test {
+			t.Fatal("ja3 字符串不一致: ", test, spec.String())
+		}
+	}
+}
+
+// 用于构造client hello
+func vector16(data []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(data))), data...)
+}
+func uint16Bytes(vals ...uint16) []byte {
+	var data []byte
+	for _, val := range vals {
+		data = binary.BigEndian.AppendUint16(data, val)
+	}
+	return data
+}
+func buildClientHello(ciphers []uint16, extensions [][]byte) []byte {
+	body := append([]byte{3, 3}, make([]byte, 32)...) //version,random
+	body = append(body, 0)                            //session id
+	body = append(body, vector16(uint16Bytes(ciphers...))...)
+	body = append(body, 1, 0) //compression
+	var exts []byte
+	for _, ext := range extensions {
+		exts = append(exts, ext...)
+	}
+	body = append(body, vector16(exts)...)
+	return append([]byte{1, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+func extension(id uint16, data []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, id), vector16(data)...)
+}
+func ja4Hash(val string) string {
+	hash := sha256.Sum256([]byte(val))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+func TestClientHelloFingerprint(t *testing.T) {
+	//https://tls13.xargs.org 中的client hello
+	xargs, _ := hex.DecodeString("010000f40303000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20e0e1e2e3e4e5e6e7e8e9eaebecedeeeff0f1f2f3f4f5f6f7f8f9fafbfcfdfeff000813021303130100ff010000a30000001800160000136578616d706c652e756c666865696d2e6e6574000b000403000102000a00160014001d0017001e0019001801000101010201030104002300000016000000170000000d001e001c040305030603080708080809080a080b080408050806040105010601002b0003020304002d00020101003300260024001d0020358072d6365880d1aeea329adf9121383851ed21a28e3b75e965d0d2cd166254")
+	//chrome 的client hello,包括grease 和alpn,ja4 使用文档中的例子
+	chromeCiphers := []uint16{0x0a0a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035}
+	chrome := buildClientHello(chromeCiphers, [][]byte{
+		extension(0x1a1a, nil),
+		extension(0x0000, vector16(append([]byte{0}, vector16([]byte("example.com"))...))),
+		extension(0x0017, nil),
+		extension(0xff01, []byte{0}),
+		extension(0x000a, vector16(uint16Bytes(0x2a2a, 0x001d, 0x0017, 0x0018))),
+		extension(0x000b, []byte{1, 0}),
+		extension(0x0023, nil),
+		extension(0x0010, vector16(append(append([]byte{2}, "h2"...), append([]byte{8}, "http/1.1"...)...))),
+		extension(0x0005, []byte{1, 0, 0, 0, 0}),
+		extension(0x000d, vector16(uint16Bytes(0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601))),
+		extension(0x0012, nil),
+		extension(0x0033, nil),
+		extension(0x002d, []byte{1, 1}),
+		extension(0x002b, append([]byte{6}, uint16Bytes(0x3a3a, 0x0304, 0x0303)...)),
+		extension(0x001b, []byte{2, 0, 2}),
+		extension(0x4469, nil),
+		extension(0x0015, nil),
+		extension(0x4a4a, []byte{0}),
+	})
+	tests := []struct {
+		name       string
+		raw        []byte
+		serverName string
+		ja3        string
+		ja3n       string
+		ja4        string
+	}{
+		{
+			name:       "xargs",
+			raw:        xargs,
+			serverName: "example.ulfheim.net",
+			ja3:        "771,4866-4867-4865-255,0-11-10-35-22-23-13-43-45-51,29-23-30-25-24-256-257-258-259-260,0-1-2",
+			ja3n:       "771,4866-4867-4865-255,0-10-11-13-22-23-35-43-45-51,29-23-30-25-24-256-257-258-259-260,0-1-2",
+			ja4: "t13d041000_" + ja4Hash("00ff,1301,1302,1303") + "_" +
+				ja4Hash("000a,000b,000d,0016,0017,0023,002b,002d,0033_0403,0503,0603,0807,0808,0809,080a,080b,0804,0805,0806,0401,0501,0601"),
+		},
+		{
+			name:       "chrome",
+			raw:        chrome,
+			serverName: "example.com",
+			ja3:        "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21,29-23-24,0",
+			ja3n:       "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-5-10-11-13-16-18-21-23-27-35-43-45-51-17513-65281,29-23-24,0",
+			ja4:        "t13d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hello, err := ja3.ParseClientHello(test.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hello.ServerName != test.serverName {
+				t.Fatal("sni 错误: ", hello.ServerName)
+			}
+			if hello.Ja3() != test.ja3 {
+				t.Fatal("ja3 错误: ", hello.Ja3())
+			}
+			if hello.Ja3n() != test.ja3n {
+				t.Fatal("ja3n 错误: ", hello.Ja3n())
+			}
+			if hello.Ja4() != test.ja4 {
+				t.Fatal("ja4 错误: ", hello.Ja4())
+			}
+		})
+	}
+	if _, err := ja3.ParseClientHello(xargs[:100]); err == nil {
+		t.Fatal("不完整的client hello 没有返回错误")
+	}
+}
+
+// 客户端发送的client hello 与Ja3Spec 的ja3 一致
+func TestClientHelloCapture(t *testing.T) {
+	for _, test := range ja3Ids {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := ja3.CreateSpecWithId(test.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ja3.DelPsk(&spec) //没有会话时不会发送psk
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			ln = ja3.NewListener(ln)
+			helloCh := make(chan *ja3.RawClientHello, 1)
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					helloCh <- nil
+					return
+				}
+				defer conn.Close()
+				conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+				buf := make([]byte, 1024)
+				for ja3.GetClientHello(conn) == nil {
+					if _, err = conn.Read(buf); err != nil {
+						break
+					}
+				}
+				helloCh <- ja3.GetClientHello(conn)
+			}()
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			ctx, cnl := context.WithTimeout(context.TODO(), time.Second*5)
+			defer cnl()
+			go ja3.NewClient(ctx, conn, spec, false, &utls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+			hello := <-helloCh
+			if hello == nil {
+				t.Fatal("没有收到client hello")
+			}
+			if hello.Ja3() != spec.String() {
+				t.Fatal("ja3 不一致: ", hello.Ja3(), spec.String())
+			}
+			if hello.ServerName != "example.com" {
+				t.Fatal("sni 错误: ", hello.ServerName)
+			}
+		})
+	}
+}
+
+func TestDbAdd(t *testing.T) {
+	db := ja3.NewDb()
+	raw := "771,4865-4866,0-23,29-23,0"
+	sum := md5.Sum([]byte(raw))
+	fingerprint := hex.EncodeToString(sum[:])
+	db.Add(
+		ja3.DbEntry{Fingerprint: raw, Type: ja3.DbTypeJa3, Browser: "Chrome", Version: "114", Os: "Windows", Confidence: 0.5},
+		ja3.DbEntry{Fingerprint: fingerprint, Type: ja3.DbTypeJa3, Browser: "Edge", Version: "114", Os: "Windows", Confidence: 0.6},
+	)
+	//浏览器不同时追加,按可信度排序
+	if entry, ok := db.Lookup(fingerprint, ja3.DbTypeJa3); !ok || entry.Browser != "Edge" || len(db.Entries()) != 2 {
+		t.Fatal("追加记录错误: ", db.Entries())
+	}
+	//指纹,类型,浏览器,版本和系统都相同时覆盖
+	db.Add(ja3.DbEntry{Fingerprint: raw, Type: ja3.DbTypeJa3, Browser: "Chrome", Version: "114", Os: "Windows", Confidence: 0.9})
+	if entry, ok := db.Lookup(fingerprint, ja3.DbTypeJa3); !ok || entry.Name() != "Chrome 114 Windows" || entry.Confidence != 0.9 || len(db.Entries()) != 2 {
+		t.Fatal("覆盖记录错误: ", db.Entries())
+	}
+	//类型不同时追加
+	db.Add(ja3.DbEntry{Fingerprint: fingerprint, Type: ja3.DbTypeJa3n, Browser: "Chrome", Version: "114", Os: "Windows"})
+	if entry, ok := db.Lookup(fingerprint, ja3.DbTypeJa3n); !ok || entry.Type != ja3.DbTypeJa3n || len(db.Entries()) != 3 {
+		t.Fatal("不同类型的记录错误: ", db.Entries())
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+func TestJarRoundTrip(t *testing.T) {
+	expires := time.Now().Add(time.Hour * 24).Truncate(time.Second)
+	cookies := []requests.JarCookie{
+		{Name: "sid", Value: "123", Domain: "example.com", Path: "/", Expires: expires, Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode},
+		{Name: "lang", Value: "zh", Domain: "www.example.com", Path: "/", HostOnly: true},
+		{Name: "token", Value: "a=b", Domain: "api.example.com", Path: "/v1", Expires: expires, SameSite: http.SameSiteStrictMode},
+	}
+	con, err := requests.NewJar().Marshal(requests.JarJson)
+	if err != nil || string(con) != "[]" {
+		t.Fatal("空的jar 导出错误: ", string(con), err)
+	}
+	src := requests.NewJar()
+	if con, err = json.Marshal(cookies); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.Unmarshal(con, requests.JarJson); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		format   requests.JarFormat
+		sameSite bool //格式是否保存SameSite
+	}{
+		{name: "json", format: requests.JarJson, sameSite: true},
+		{name: "netscape", format: requests.JarNetscape},
+		{name: "chrome", format: requests.JarChrome, sameSite: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			con, err := src.Marshal(test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := requests.NewJar()
+			if err = dst.Unmarshal(con, test.format); err != nil {
+				t.Fatal(err)
+			}
+			want := src.AllCookies()
+			got := dst.AllCookies()
+			if !test.sameSite {
+				for i := range want {
+					want[i].SameSite = 0
+				}
+			}
+			if len(got) != len(cookies) || !reflect.DeepEqual(cookiesUnix(want), cookiesUnix(got)) {
+				t.Fatalf("导入导出不一致:\n%+v\n%+v\n%s", want, got, con)
+			}
+		})
+	}
+}
+
+// time.Time 中的时区和单调时钟不影响比较
+func cookiesUnix(cookies []requests.JarCookie) []requests.JarCookie {
+	for i := range cookies {
+		if !cookies[i].Expires.IsZero() {
+			cookies[i].Expires = time.Unix(cookies[i].Expires.Unix(), 0)
+		}
+	}
+	return cookies
+}
+
+func TestJarNetscape(t *testing.T) {
+	con := strings.Join([]string{
+		"# Netscape HTTP Cookie File",
+		"",
+		"#HttpOnly_.example.com\tTRUE\t/\tTRUE\t4102444800\tsid\t123",
+		"www.example.com\tFALSE\t/path\tFALSE\t0\tlang\tzh\r",
+		"example.com\tTRUE\t/\tFALSE\t4102444800\tempty",
+		"example.com\tTRUE\t/\tFALSE\t1\texpired\t1",
+	}, "\n")
+	jar := requests.NewJar()
+	if err := jar.Unmarshal([]byte(con), requests.JarNetscape); err != nil {
+		t.Fatal(err)
+	}
+	want := []requests.JarCookie{
+		{Name: "empty", Domain: "example.com", Path: "/", Expires: time.Unix(4102444800, 0)},
+		{Name: "sid", Value: "123", Domain: "example.com", Path: "/", Expires: time.Unix(4102444800, 0), Secure: true, HttpOnly: true},
+		{Name: "lang", Value: "zh", Domain: "www.example.com", Path: "/path", HostOnly: true},
+	}
+	if got := cookiesUnix(jar.AllCookies()); !reflect.DeepEqual(want, got) {
+		t.Fatalf("cookies.txt 解析错误:\n%+v\n%+v", want, got)
+	}
+	if err := jar.Unmarshal([]byte("example.com\tTRUE\t/"), requests.JarNetscape); err == nil {
+		t.Fatal("格式错误的cookies.txt 没有返回错误")
+	}
+}
+
+func TestLoadJar(t *testing.T) {
+	path := t.TempDir() + "/cookies.txt"
+	jar, err := requests.LoadJar(requests.JarOption{File: path, Format: requests.JarNetscape, SaveDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err = jar.Cookies("https://www.example.com/", fmt.Sprintf("a=%d; b=2", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = os.Stat(path); err == nil {
+		t.Fatal("cookies 在请求中同步保存")
+	}
+	if err = jar.Close(); err != nil {
+		t.Fatal(err)
+	}
+	jar2, err := requests.LoadJar(requests.JarOption{File: path, Format: requests.JarNetscape})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jar.AllCookies(), jar2.AllCookies()) || len(jar2.AllCookies()) != 2 {
+		t.Fatal("cookies 没有保存到文件: ", jar2.AllCookies())
+	}
+	//延迟后在后台保存,失败时调用ErrCallBack
+	saveErr := make(chan error, 1)
+	jar3, err := requests.LoadJar(requests.JarOption{File: t.TempDir() + "/no/cookies.txt", SaveDelay: time.Millisecond * 10, ErrCallBack: func(err error) { saveErr <- err }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar3.Cookies("https://www.example.com/", "a=1")
+	select {
+	case err = <-saveErr:
+		if err == nil {
+			t.Fatal("保存失败时ErrCallBack 的错误为空")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("保存失败时没有调用ErrCallBack")
+	}
+	if err = jar3.Close(); err == nil {
+		t.Fatal("Close 时没有重试保存失败的修改")
+	}
+}
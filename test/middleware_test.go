@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+// 有没有中间件时重定向的行为一致
+func TestMiddlewareRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		num, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if num > 0 {
+			http.Redirect(w, r, "/"+strconv.Itoa(num-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	reqCli, err := requests.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		redirectNum int
+		path        string //最后一个请求的路径
+		status      int
+		handlerNum  int //中间件执行次数,每次重定向都会执行
+	}{
+		{name: "unlimited", redirectNum: 0, path: "/0", status: 200, handlerNum: 16},
+		{name: "limit", redirectNum: 3, path: "/12", status: 302, handlerNum: 4},
+		{name: "disable", redirectNum: -1, path: "/15", status: 302, handlerNum: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var handlerNum int
+			middleware := func(next requests.Handler) requests.Handler {
+				return func(ctx context.Context, option *requests.RequestOption) (*requests.Response, error) {
+					handlerNum++
+					return next(ctx, option)
+				}
+			}
+			for _, middlewares := range [][]requests.Middleware{nil, {middleware}} {
+				resp, err := reqCli.Request(nil, "get", server.URL+"/15", requests.RequestOption{RedirectNum: test.redirectNum, Middlewares: middlewares})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.Url().Path != test.path || resp.StatusCode() != test.status {
+					t.Fatal("重定向结果错误: ", len(middlewares), resp.Url().Path, resp.StatusCode())
+				}
+			}
+			if handlerNum != test.handlerNum {
+				t.Fatal("中间件执行次数错误: ", handlerNum)
+			}
+		})
+	}
+}
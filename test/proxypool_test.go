@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+func TestProxyPool(t *testing.T) {
+	pool, err := requests.NewProxyPool(nil, requests.ProxyPoolOption{
+		Proxys:  []string{"127.0.0.1:7001", "http://127.0.0.1:7002", "socks5://127.0.0.1:7003"},
+		MaxFail: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	proxys := []string{"http://127.0.0.1:7001", "http://127.0.0.1:7002", "socks5://127.0.0.1:7003"}
+	stats := pool.Stats()
+	if len(stats) != len(proxys) {
+		t.Fatal("代理数量错误: ", stats)
+	}
+	for i, stat := range stats {
+		if stat.Proxy != proxys[i] || stat.Weight != 1 {
+			t.Fatal("代理格式错误: ", stat)
+		}
+	}
+	//轮询时每个代理都会被选到
+	counts := map[string]int{}
+	for i := 0; i < 6; i++ {
+		proxy, err := pool.GetProxy(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[proxy]++
+	}
+	for _, proxy := range proxys {
+		if counts[proxy] != 2 {
+			t.Fatal("轮询错误: ", counts)
+		}
+	}
+	//连续失败MaxFail 次后禁用
+	pool.Fail(proxys[0])
+	pool.Fail(proxys[0])
+	for i := 0; i < 4; i++ {
+		if proxy, _ := pool.GetProxy(nil, nil); proxy == proxys[0] {
+			t.Fatal("禁用的代理被选择")
+		}
+	}
+	pool.Success(proxys[0], time.Millisecond*100)
+	if stat := pool.Stats()[0]; stat.Banned || stat.Success != 1 || stat.Fail != 2 || stat.Latency != time.Millisecond*100 {
+		t.Fatal("代理状态错误: ", stat)
+	}
+	//相同key 使用相同代理
+	ctx := requests.WithProxyKey(nil, "user1")
+	sticky, err := pool.GetProxy(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if proxy, _ := pool.GetProxy(ctx, nil); proxy != sticky {
+			t.Fatal("粘性会话的代理不一致: ", proxy, sticky)
+		}
+	}
+	//链式代理
+	if err = pool.Add("127.0.0.1:7004, socks5://127.0.0.1:7005", 3); err != nil {
+		t.Fatal(err)
+	}
+	if stat := pool.Stats()[3]; stat.Proxy != "http://127.0.0.1:7004,socks5://127.0.0.1:7005" || stat.Weight != 3 {
+		t.Fatal("链式代理错误: ", stat)
+	}
+	if err = pool.Add("ftp://127.0.0.1:7006", 1); err == nil {
+		t.Fatal("不支持的代理协议没有返回错误")
+	}
+	for _, proxy := range []string{"127.0.0.1:7001", "127.0.0.1:7002", "socks5://127.0.0.1:7003", "127.0.0.1:7004,socks5://127.0.0.1:7005"} {
+		pool.Del(proxy)
+	}
+	if _, err = pool.GetProxy(nil, nil); err == nil {
+		t.Fatal("代理池为空时没有返回错误")
+	}
+}
+
+// 创建时先检查一次,代理返回的错误状态码为失败
+func TestProxyPoolCheck(t *testing.T) {
+	newProxy := func(statusCode int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(statusCode)
+		}))
+	}
+	okProxy, authProxy, badProxy := newProxy(200), newProxy(407), newProxy(502)
+	defer okProxy.Close()
+	defer authProxy.Close()
+	defer badProxy.Close()
+	deadProxy := newProxy(200)
+	deadProxy.Close()
+	pool, err := requests.NewProxyPool(nil, requests.ProxyPoolOption{
+		Proxys:       []string{okProxy.URL, authProxy.URL, badProxy.URL, deadProxy.URL},
+		CheckUrl:     "http://check.gospider.test/",
+		CheckTimeout: time.Second * 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for _, stat := range pool.Stats() {
+		if ok := stat.Proxy == okProxy.URL; stat.Banned == ok || (stat.Success == 1) != ok {
+			t.Fatal("健康检查结果错误: ", stat)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if proxy, err := pool.GetProxy(nil, nil); err != nil || proxy != okProxy.URL {
+			t.Fatal("返回了没有通过检查的代理: ", proxy, err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/justseemore/gospider/requests"
+)
+
+// 记录重试策略返回的等待时间
+type recordRetry struct {
+	policy requests.RetryPolicy
+	delays []time.Duration
+	lock   sync.Mutex
+}
+
+func (obj *recordRetry) Retry(ctx context.Context, tryNum int64, resp *requests.Response, err error) (time.Duration, bool) {
+	delay, ok := obj.policy.Retry(ctx, tryNum, resp, err)
+	if ok {
+		obj.lock.Lock()
+		obj.delays = append(obj.delays, delay)
+		obj.lock.Unlock()
+	}
+	return delay, ok
+}
+
+// 按顺序返回状态码和Retry-After,之后返回200
+type retryServer struct {
+	replys [][2]string
+	num    int
+	lock   sync.Mutex
+}
+
+func (obj *retryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	obj.lock.Lock()
+	num := obj.num
+	obj.num++
+	obj.lock.Unlock()
+	if num >= len(obj.replys) {
+		w.Write([]byte("ok"))
+		return
+	}
+	if obj.replys[num][1] != "" {
+		w.Header().Set("Retry-After", obj.replys[num][1])
+	}
+	statusCode, _ := strconv.Atoi(obj.replys[num][0])
+	w.WriteHeader(statusCode)
+}
+func (obj *retryServer) requestNum() int {
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	return obj.num
+}
+
+func TestBackoffRetry(t *testing.T) {
+	reqCli, err := requests.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	option := requests.BackoffOption{Base: time.Millisecond * 10, Max: time.Millisecond * 50, DisJitter: true}
+	retryAt := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name    string
+		option  requests.BackoffOption
+		replys  [][2]string
+		status  int
+		handNum int
+		delays  []time.Duration
+	}{
+		{
+			name:    "backoff",
+			option:  option,
+			replys:  [][2]string{{"500"}, {"502"}, {"504"}},
+			status:  200,
+			handNum: 4,
+			delays:  []time.Duration{time.Millisecond * 10, time.Millisecond * 20, time.Millisecond * 40},
+		},
+		{
+			name:    "max delay",
+			option:  requests.BackoffOption{MaxTry: 5, Base: time.Millisecond * 10, Max: time.Millisecond * 30, DisJitter: true},
+			replys:  [][2]string{{"500"}, {"500"}, {"500"}, {"500"}},
+			status:  200,
+			handNum: 5,
+			delays:  []time.Duration{time.Millisecond * 10, time.Millisecond * 20, time.Millisecond * 30, time.Millisecond * 30},
+		},
+		{
+			name:    "max try",
+			option:  option,
+			replys:  [][2]string{{"503"}, {"503"}, {"503"}, {"503"}},
+			status:  503,
+			handNum: 4,
+			delays:  []time.Duration{time.Millisecond * 10, time.Millisecond * 20, time.Millisecond * 40},
+		},
+		{
+			name:    "status codes",
+			option:  option,
+			replys:  [][2]string{{"404"}},
+			status:  404,
+			handNum: 1,
+		},
+		{
+			name:    "custom status codes",
+			option:  requests.BackoffOption{Base: time.Millisecond * 10, DisJitter: true, StatusCodes: []int{404}},
+			replys:  [][2]string{{"404"}, {"500"}},
+			status:  500,
+			handNum: 2,
+			delays:  []time.Duration{time.Millisecond * 10},
+		},
+		{
+			name:    "retry after",
+			option:  requests.BackoffOption{Base: time.Millisecond * 10, Max: time.Second * 2, DisJitter: true},
+			replys:  [][2]string{{"429", "1"}},
+			status:  200,
+			handNum: 2,
+			delays:  []time.Duration{time.Second},
+		},
+		{
+			name:    "retry after max",
+			option:  option,
+			replys:  [][2]string{{"429", "120"}, {"503", retryAt}},
+			status:  200,
+			handNum: 3,
+			delays:  []time.Duration{time.Millisecond * 50, time.Millisecond * 50},
+		},
+		{
+			name:    "retry after invalid",
+			option:  option,
+			replys:  [][2]string{{"503", "later"}, {"503", "0"}},
+			status:  200,
+			handNum: 3,
+			delays:  []time.Duration{time.Millisecond * 10, time.Millisecond * 20},
+		},
+		{
+			name:    "retry after ignored",
+			option:  option,
+			replys:  [][2]string{{"500", "120"}},
+			status:  200,
+			handNum: 2,
+			delays:  []time.Duration{time.Millisecond * 10},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &retryServer{replys: test.replys}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			policy := &recordRetry{policy: requests.NewBackoffRetry(test.option)}
+			resp, err := reqCli.Request(nil, "get", server.URL, requests.RequestOption{RetryPolicy: policy, DisCache: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode() != test.status {
+				t.Fatal("状态码错误: ", resp.StatusCode())
+			}
+			if num := handler.requestNum(); num != test.handNum {
+				t.Fatal("请求次数错误: ", num)
+			}
+			if fmt.Sprint(policy.delays) != fmt.Sprint(test.delays) {
+				t.Fatal("等待时间错误: ", policy.delays)
+			}
+		})
+	}
+}
+
+// 开启抖动时等待时间在(0,delay] 之间
+func TestBackoffRetryJitter(t *testing.T) {
+	policy := requests.NewBackoffRetry(requests.BackoffOption{Base: time.Millisecond * 10, Max: time.Millisecond * 50})
+	for tryNum := int64(1); tryNum <= 3; tryNum++ {
+		maxDelay := time.Millisecond * 10 << (tryNum - 1)
+		for i := 0; i < 100; i++ {
+			delay, ok := policy.Retry(nil, tryNum, nil, syscall.ECONNRESET)
+			if !ok || delay <= 0 || delay > maxDelay {
+				t.Fatal("抖动的等待时间错误: ", tryNum, delay)
+			}
+		}
+	}
+}
+
+func TestBackoffRetryErr(t *testing.T) {
+	policy := requests.NewBackoffRetry(requests.BackoffOption{Base: time.Millisecond * 10, DisJitter: true})
+	tests := []struct {
+		err   error
+		retry bool
+	}{
+		{err: &net.DNSError{Err: "no such host", Name: "gospider.test", IsNotFound: true}, retry: true},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, retry: true},
+		{err: io.ErrUnexpectedEOF, retry: true},
+		{err: context.DeadlineExceeded, retry: true},
+		{err: context.Canceled},
+		{err: &requests.ProxyError{Proxy: "http://127.0.0.1:7001", StatusCode: 407, AuthFailed: true}},
+		{err: errors.New("unknown")},
+	}
+	for _, test := range tests {
+		delay, ok := policy.Retry(nil, 1, nil, test.err)
+		if ok != test.retry || (ok && delay != time.Millisecond*10) {
+			t.Fatal("错误的重试结果错误: ", test.err, ok, delay)
+		}
+	}
+	//自定义错误类型
+	policy = requests.NewBackoffRetry(requests.BackoffOption{DisJitter: true, ErrTypes: []requests.ErrType{requests.ErrTypeProxy}})
+	if _, ok := policy.Retry(nil, 1, nil, &requests.ProxyError{}); !ok {
+		t.Fatal("自定义的错误类型没有重试")
+	}
+	if _, ok := policy.Retry(nil, 1, nil, io.EOF); ok {
+		t.Fatal("不在ErrTypes 中的错误被重试")
+	}
+}
+
+func TestGetErrType(t *testing.T) {
+	wrap := func(err error) error {
+		return fmt.Errorf("请求错误: %w", err)
+	}
+	tests := []struct {
+		err     error
+		errType requests.ErrType
+	}{
+		{err: nil, errType: requests.ErrTypeUnknown},
+		{err: errors.New("unknown"), errType: requests.ErrTypeUnknown},
+		{err: wrap(&net.DNSError{Err: "no such host", Name: "gospider.test", IsNotFound: true}), errType: requests.ErrTypeDns},
+		{err: wrap(&net.DNSError{Err: "i/o timeout", Name: "gospider.test", IsTimeout: true}), errType: requests.ErrTypeDns},
+		{err: wrap(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), errType: requests.ErrTypeDial},
+		{err: wrap(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.EHOSTUNREACH}), errType: requests.ErrTypeDial},
+		{err: wrap(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), errType: requests.ErrTypeReset},
+		{err: wrap(&net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}), errType: requests.ErrTypeReset},
+		{err: wrap(io.ErrUnexpectedEOF), errType: requests.ErrTypeReset},
+		{err: wrap(io.EOF), errType: requests.ErrTypeReset},
+		{err: wrap(context.DeadlineExceeded), errType: requests.ErrTypeTimeout},
+		{err: wrap(os.ErrDeadlineExceeded), errType: requests.ErrTypeTimeout},
+		{err: wrap(context.Canceled), errType: requests.ErrTypeCancel},
+		{err: wrap(x509.UnknownAuthorityError{}), errType: requests.ErrTypeTls},
+		{err: wrap(x509.HostnameError{Certificate: &x509.Certificate{}, Host: "gospider.test"}), errType: requests.ErrTypeTls},
+		{err: errors.New("tls: handshake failure"), errType: requests.ErrTypeTls},
+		{err: wrap(&requests.ProxyError{Proxy: "socks5://127.0.0.1:7003", StatusCode: 5, Status: "connection refused"}), errType: requests.ErrTypeProxy},
+	}
+	for _, test := range tests {
+		if errType := requests.GetErrType(test.err); errType != test.errType {
+			t.Fatal("错误分类错误: ", test.err, errType, test.errType)
+		}
+	}
+	//真实请求的错误
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	reqCli, err := requests.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reqCli.Request(nil, "get", "http://"+addr); requests.GetErrType(err) != requests.ErrTypeDial {
+		t.Fatal("连接被拒绝的分类错误: ", err)
+	}
+	ctx, cnl := context.WithCancel(context.TODO())
+	cnl()
+	if _, err = reqCli.Request(ctx, "get", "http://"+addr); requests.GetErrType(err) != requests.ErrTypeCancel {
+		t.Fatal("取消请求的分类错误: ", err)
+	}
+}
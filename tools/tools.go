@@ -749,25 +749,26 @@ func CopyWitchContext(ctx context.Context, writer io.Writer, reader io.ReadClose
 		return
 	}
 	p := make(chan struct{})
+	var copyErr error //ctx 结束时直接返回,copy 的错误不能和返回值共用
 	go func() {
 		defer func() {
-			if recErr := recover(); recErr != nil && err == nil {
-				err = errors.New(fmt.Sprint(recErr))
+			if recErr := recover(); recErr != nil && copyErr == nil {
+				copyErr = errors.New(fmt.Sprint(recErr))
 			}
 			close(p)
 		}()
-		_, err = io.Copy(writer, reader)
-		if err != nil && errors.Is(err, io.ErrUnexpectedEOF) {
-			err = nil
+		_, copyErr = io.Copy(writer, reader)
+		if copyErr != nil && errors.Is(copyErr, io.ErrUnexpectedEOF) {
+			copyErr = nil
 		}
 	}()
 	select {
 	case <-ctx.Done():
 		reader.Close()
-		err = ctx.Err()
+		return ctx.Err()
 	case <-p:
+		return copyErr
 	}
-	return
 }
 func ParseHost(host string) (net.IP, int) {
 	if ip := net.ParseIP(host); ip != nil {